@@ -0,0 +1,275 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/alex123012/gitdeps/pkg/webhook"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	caFileName    = "ca.crt"
+	caKeyFileName = "ca.key"
+)
+
+var (
+	outDir      string
+	output      = "files"
+	keyType     string
+	keySize     int
+	validity    time.Duration
+	dnsNames    []string
+	ipAddresses []string
+
+	caFile   string
+	certFile string
+	keyFile  string
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cert",
+		Short: "Manage webhook certificates offline",
+	}
+
+	cmd.AddCommand(
+		NewGenerateCmd(),
+		NewInspectCmd(),
+		NewVerifyCmd(),
+	)
+
+	return cmd
+}
+
+func NewGenerateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate CA and webhook serving certificate",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			conf := common.Config.WebhookConf
+			tlsConf := &conf.Tls
+			if cmd.Flags().Changed("key-type") {
+				tlsConf.KeyType = keyType
+			}
+			if cmd.Flags().Changed("key-size") {
+				tlsConf.KeySize = keySize
+			}
+			if cmd.Flags().Changed("validity") {
+				tlsConf.Validity = validity
+			}
+			tlsConf.DNSNames = append(tlsConf.DNSNames, dnsNames...)
+			tlsConf.IPAddresses = append(tlsConf.IPAddresses, ipAddresses...)
+
+			certs, err := webhook.GenerateCertificate(conf, false)
+			if err != nil {
+				return err
+			}
+
+			switch output {
+			case "files":
+				return WriteCertificateFiles(conf, certs)
+			case "secret":
+				if conf.Tls.Secret.Name == "" {
+					conf.Tls.Secret.Name = fmt.Sprintf("%s-tls", config.ApplicationName)
+				}
+				res, err := yaml.Marshal(webhook.CertificateSecret(conf, certs))
+				if err != nil {
+					return err
+				}
+				fmt.Print(string(res))
+				return nil
+			}
+			return fmt.Errorf("not valid output %q, use one of [files, secret]", output)
+		},
+	}
+
+	cmd.Flags().StringVar(&outDir, "out-dir", "", "Directory to write certificates to (default tls.path from config)")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format: files or secret (Secret manifest to stdout)")
+	cmd.Flags().StringVar(&keyType, "key-type", "rsa", "Private key type: rsa, ecdsa or ed25519")
+	cmd.Flags().IntVar(&keySize, "key-size", 0, "RSA modulus size or ECDSA curve size (default 4096 for rsa, 256 for ecdsa)")
+	cmd.Flags().DurationVar(&validity, "validity", 365*24*time.Hour, "Certificates validity period")
+	cmd.Flags().StringSliceVar(&dnsNames, "dns-name", nil, "Additional DNS SANs of the serving certificate")
+	cmd.Flags().StringSliceVar(&ipAddresses, "ip-address", nil, "Additional IP SANs of the serving certificate")
+	return cmd
+}
+
+func NewInspectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect [FILE...]",
+		Short: "Show subject, SANs and expiry of certificates",
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				tlsConf := common.Config.WebhookConf.Tls
+				args = []string{
+					path.Join(tlsConf.Path, caFileName),
+					path.Join(tlsConf.Path, tlsConf.CertFile),
+				}
+			}
+
+			for _, file := range args {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				certs, err := webhook.ParseCertificates(data)
+				if err != nil {
+					return fmt.Errorf("%s: %w", file, err)
+				}
+				for _, cert := range certs {
+					fmt.Printf("%s:\n%s\n", file, DescribeCertificate(cert, time.Now()))
+				}
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func NewVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that the serving certificate chains to the CA and matches the service DNS names",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			conf := common.Config.WebhookConf
+
+			caData, err := os.ReadFile(valueOrDefault(caFile, path.Join(conf.Tls.Path, caFileName)))
+			if err != nil {
+				return err
+			}
+			certData, err := os.ReadFile(valueOrDefault(certFile, path.Join(conf.Tls.Path, conf.Tls.CertFile)))
+			if err != nil {
+				return err
+			}
+
+			var keyData []byte
+			if keyFile != "" {
+				if keyData, err = os.ReadFile(keyFile); err != nil {
+					return err
+				}
+			}
+
+			if err := VerifyCertificate(conf, caData, certData, keyData); err != nil {
+				return err
+			}
+			hclog.L().Info("Certificate is valid")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&caFile, "ca", "", "CA certificate file (default ca.crt in tls.path from config)")
+	cmd.Flags().StringVar(&certFile, "cert", "", "Serving certificate file (default tls.cert_file from config)")
+	cmd.Flags().StringVar(&keyFile, "key", "", "Serving certificate private key file to check it matches the certificate")
+	return cmd
+}
+
+// WriteCertificateFiles writes CA and serving certificates with their keys to the output directory
+func WriteCertificateFiles(conf config.WebHookConf, certs map[string]*bytes.Buffer) error {
+	dir := valueOrDefault(outDir, conf.Tls.Path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data *bytes.Buffer
+		perm os.FileMode
+	}{
+		{caFileName, certs["ca"], webhook.CertificateFileMode},
+		{caKeyFileName, certs["ca-key"], webhook.PrivateKeyFileMode},
+		{valueOrDefault(conf.Tls.CertFile, "tls.crt"), certs["cert"], webhook.CertificateFileMode},
+		{valueOrDefault(conf.Tls.KeyFile, "tls.key"), certs["key"], webhook.PrivateKeyFileMode},
+	}
+	for _, f := range files {
+		file := path.Join(dir, f.name)
+		if err := webhook.WriteFile(file, f.data, f.perm); err != nil {
+			return err
+		}
+		hclog.L().Info("Written", "file", file)
+	}
+	return nil
+}
+
+// VerifyCertificate checks that the serving certificate chains to the CA,
+// is valid for every webhook service DNS name and matches the private key if it is given
+func VerifyCertificate(conf config.WebHookConf, caPEM, certPEM, keyPEM []byte) error {
+	cas, err := webhook.ParseCertificates(caPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA: %w", err)
+	}
+	cert, err := webhook.ParseCertificate(certPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+
+	names := append(webhook.ServiceDNSNames(conf), conf.Tls.DNSNames...)
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	for _, name := range names {
+		_, err := cert.Verify(x509.VerifyOptions{
+			DNSName:   name,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if err != nil {
+			return fmt.Errorf("certificate is not valid for %q: %w", name, err)
+		}
+	}
+
+	if len(keyPEM) > 0 {
+		if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			return fmt.Errorf("private key doesn't match certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// DescribeCertificate returns human readable certificate summary
+func DescribeCertificate(cert *x509.Certificate, now time.Time) string {
+	ips := make([]string, 0, len(cert.IPAddresses))
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+
+	expiry := fmt.Sprintf("expires in %s", cert.NotAfter.Sub(now).Round(time.Hour))
+	if now.After(cert.NotAfter) {
+		expiry = "expired"
+	}
+
+	lines := []string{
+		fmt.Sprintf("  Subject:      %s", cert.Subject),
+		fmt.Sprintf("  Issuer:       %s", cert.Issuer),
+		fmt.Sprintf("  Serial:       %s", cert.SerialNumber.Text(16)),
+		fmt.Sprintf("  CA:           %t", cert.IsCA),
+		fmt.Sprintf("  Key:          %s", cert.PublicKeyAlgorithm),
+		fmt.Sprintf("  DNS names:    %s", strings.Join(cert.DNSNames, ", ")),
+		fmt.Sprintf("  IP addresses: %s", strings.Join(ips, ", ")),
+		fmt.Sprintf("  Not before:   %s", cert.NotBefore.Format(time.RFC3339)),
+		fmt.Sprintf("  Not after:    %s (%s)", cert.NotAfter.Format(time.RFC3339), expiry),
+	}
+	return strings.Join(lines, "\n")
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -12,6 +12,7 @@ func NewCmd() *cobra.Command {
 
 	cmd.AddCommand(
 		NewDefaultCmd(),
+		NewSubmodulesCmd(),
 	)
 
 	return cmd
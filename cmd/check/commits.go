@@ -7,6 +7,8 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/commits"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -21,6 +23,7 @@ var (
 	targetRef  = "HEAD"
 	path       = "./"
 	fetch      = false
+	paths      []string
 )
 
 func NewDefaultCmd() *cobra.Command {
@@ -29,7 +32,11 @@ func NewDefaultCmd() *cobra.Command {
 		Short: "",
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			ctx := cmd.Context()
-			haveAll, err := TargetHaveAllCommitsFromOtherBranch(ctx, fetch, path, compareRef, targetRef)
+			filter, err := commits.NewFilter(common.Config.IgnoreCommits)
+			if err != nil {
+				return err
+			}
+			haveAll, err := TargetHaveAllCommitsFromOtherBranch(ctx, fetch, path, compareRef, targetRef, filter.WithScope(paths))
 			if !haveAll && err == nil {
 				return fmt.Errorf("branch '%s' haven't some commits from '%s'", targetRef, compareRef)
 			}
@@ -45,10 +52,12 @@ func NewDefaultCmd() *cobra.Command {
 
 	cmd.Flags().BoolVar(&fetch, "fetch", fetch, "")
 
+	cmd.Flags().StringSliceVar(&paths, "paths", nil, "Component path globs, only commits changing them are required")
+
 	return cmd
 }
 
-func TargetHaveAllCommitsFromOtherBranch(ctx context.Context, fetch bool, path, compareRef, targetRef string) (bool, error) {
+func TargetHaveAllCommitsFromOtherBranch(ctx context.Context, fetch bool, path, compareRef, targetRef string, filter *commits.Filter) (bool, error) {
 
 	r, err := git.PlainOpen(path)
 	if err != nil {
@@ -151,12 +160,92 @@ func TargetHaveAllCommitsFromOtherBranch(ctx context.Context, fetch bool, path,
 		}
 	}
 
+	if !res && !filter.Empty() {
+		missing, err := MissingCommits(compareCommit, targetCommit, filter)
+		if err != nil {
+			return false, err
+		}
+		if len(missing) == 0 {
+			hclog.L().Info(fmt.Sprintf("Commits from %s missing in %s are ignored", compareRef, targetRef))
+			return true, nil
+		}
+	}
+
 	if !res {
 		return false, nil
 	}
 	return true, nil
 }
 
+// MissingCommits returns commits from compareCommit history which are not
+// in targetCommit history and are not ignored by the filter
+func MissingCommits(compareCommit, targetCommit *object.Commit, filter *commits.Filter) ([]*object.Commit, error) {
+	targetHistory := make(map[plumbing.Hash]bool)
+	err := object.NewCommitPreorderIter(targetCommit, nil, nil).ForEach(func(commit *object.Commit) error {
+		targetHistory[commit.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []*object.Commit
+	err = object.NewCommitPreorderIter(compareCommit, targetHistory, nil).ForEach(func(commit *object.Commit) error {
+		ignored, err := filter.Ignored(commits.Commit{
+			AuthorName:  commit.Author.Name,
+			AuthorEmail: commit.Author.Email,
+			Message:     commit.Message,
+			Files: func() ([]string, error) {
+				return CommitFiles(commit)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if !ignored {
+			missing = append(missing, commit)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// CommitFiles returns paths changed by the commit compared to its first parent
+func CommitFiles(commit *object.Commit) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.To.Name != "" {
+			files = append(files, change.To.Name)
+		}
+		if change.From.Name != "" && change.From.Name != change.To.Name {
+			files = append(files, change.From.Name)
+		}
+	}
+	return files, nil
+}
+
 func ResolveRevisionBranchHead(r *git.Repository, s string) (*plumbing.Hash, error) {
 	return r.ResolveRevision(plumbing.Revision(s))
 }
@@ -0,0 +1,178 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+)
+
+// submoduleCompareRef is empty to compare with the default branch of every submodule remote
+var submoduleCompareRef string
+
+func NewSubmodulesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "submodules",
+		Short: "",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			stale, err := StaleSubmodules(ctx, fetch, path, submoduleCompareRef, targetRef)
+			if len(stale) > 0 && err == nil {
+				return fmt.Errorf("submodules %s of '%s' pin commits that are not in %s of the submodules",
+					strings.Join(stale, ", "), targetRef, describeCompareRef(submoduleCompareRef))
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&path, "git-path", path, "")
+
+	cmd.Flags().StringVar(&submoduleCompareRef, "compare-ref", submoduleCompareRef, "Ref of the submodule repositories pinned commits must be reachable from, defaults to the default branch of the submodule remote")
+
+	cmd.Flags().StringVar(&targetRef, "target-ref", targetRef, "")
+
+	cmd.Flags().BoolVar(&fetch, "fetch", fetch, "Fetch the submodule repositories")
+
+	return cmd
+}
+
+// StaleSubmodules returns paths of submodules whose commits pinned at targetRef
+// are not reachable from compareRef of the submodule repositories, or from their
+// remote default branch if compareRef is empty. Submodules are read from the worktree
+// and must be initialized, those missing at targetRef are skipped.
+func StaleSubmodules(ctx context.Context, fetch bool, path, compareRef, targetRef string) ([]string, error) {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	targetHash, err := ResolveRevisionBranchHead(r, targetRef)
+	if err != nil {
+		return nil, err
+	}
+	targetCommit, err := r.CommitObject(*targetHash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := targetCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for _, submodule := range submodules {
+		module := submodule.Config()
+		entry, err := tree.FindEntry(module.Path)
+		if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+			hclog.L().Debug(fmt.Sprintf("Submodule %s is not in %s", module.Path, targetRef))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("submodule %s: %w", module.Path, err)
+		}
+		if entry.Mode != filemode.Submodule {
+			return nil, fmt.Errorf("submodule %s is not a submodule entry in %s", module.Path, targetRef)
+		}
+
+		submoduleRepository, err := submodule.Repository()
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			return nil, fmt.Errorf("submodule %s is not initialized", module.Path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("submodule %s: %w", module.Path, err)
+		}
+		if fetch {
+			err := submoduleRepository.FetchContext(ctx, &git.FetchOptions{})
+			if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+				return nil, err
+			}
+		}
+
+		submoduleRef := compareRef
+		if submoduleRef == "" {
+			if submoduleRef, err = RemoteDefaultBranch(ctx, submoduleRepository); err != nil {
+				return nil, fmt.Errorf("submodule %s: %w", module.Path, err)
+			}
+		}
+		compareHash, err := ResolveRevisionBranchHead(submoduleRepository, submoduleRef)
+		if err != nil {
+			return nil, fmt.Errorf("submodule %s: %s: %w", module.Path, submoduleRef, err)
+		}
+		compareCommit, err := submoduleRepository.CommitObject(*compareHash)
+		if err != nil {
+			return nil, err
+		}
+
+		pinnedCommit, err := submoduleRepository.CommitObject(entry.Hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			hclog.L().Info(fmt.Sprintf("Submodule %s pins %s which is not found", module.Path, entry.Hash))
+			stale = append(stale, module.Path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		reachable, err := pinnedCommit.IsAncestor(compareCommit)
+		if err != nil {
+			return nil, err
+		}
+		if !reachable {
+			hclog.L().Info(fmt.Sprintf("Submodule %s pins %s which is not in %s", module.Path, entry.Hash, submoduleRef))
+			stale = append(stale, module.Path)
+		}
+	}
+
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// RemoteDefaultBranch returns remote tracking ref of the origin default branch.
+// It is read from origin/HEAD or, as submodule clones usually don't have it, asked from the remote
+func RemoteDefaultBranch(ctx context.Context, r *git.Repository) (string, error) {
+	head, err := r.Reference(plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName), false)
+	if err == nil && head.Type() == plumbing.SymbolicReference {
+		return head.Target().String(), nil
+	}
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return "", err
+	}
+
+	remote, err := r.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return "", err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list %s refs: %w", git.DefaultRemoteName, err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference && ref.Target().IsBranch() {
+			return plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ref.Target().Short()).String(), nil
+		}
+	}
+	return "", fmt.Errorf("default branch of %s is not known", git.DefaultRemoteName)
+}
+
+func describeCompareRef(compareRef string) string {
+	if compareRef == "" {
+		return "the default branches"
+	}
+	return fmt.Sprintf("'%s'", compareRef)
+}
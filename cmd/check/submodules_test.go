@@ -0,0 +1,80 @@
+package check
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// initRemote creates a repository with a commit on its default branch
+func initRemote(t *testing.T, defaultBranch string) string {
+	t.Helper()
+	dir := t.TempDir()
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(defaultBranch))
+	if err := r.Storer.SetReference(head); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("lib"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("README"); err != nil {
+		t.Fatal(err)
+	}
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := worktree.Commit("init", &git.CommitOptions{Author: signature}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRemoteDefaultBranch(t *testing.T) {
+	remote := initRemote(t, "trunk")
+	tests := []struct {
+		name       string
+		originHEAD string
+		want       string
+	}{
+		{name: "origin head", originHEAD: "refs/remotes/origin/stable", want: "refs/remotes/origin/stable"},
+		{name: "asked from remote", want: "refs/remotes/origin/trunk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := git.PlainInit(t.TempDir(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.CreateRemote(&gitconfig.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remote}}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.originHEAD != "" {
+				head := plumbing.NewSymbolicReference(plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName), plumbing.ReferenceName(tt.originHEAD))
+				if err := r.Storer.SetReference(head); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := RemoteDefaultBranch(context.Background(), r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("RemoteDefaultBranch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,10 @@ func Init() (err error) {
 	if err = viper.Unmarshal(&cfg); err != nil {
 		return err
 	}
+	// service defaults are set even if the webhook uses url clientConfig
+	if cfg.WebhookConf.Webhook.ClientConfig.URL != nil {
+		cfg.WebhookConf.Webhook.ClientConfig.Service = nil
+	}
 
 	Config = &cfg
 
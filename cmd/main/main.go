@@ -6,10 +6,12 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	dconfig "github.com/alex123012/gitdeps/pkg/config"
 	v1 "k8s.io/api/admissionregistration/v1"
 
+	"github.com/alex123012/gitdeps/cmd/cert"
 	"github.com/alex123012/gitdeps/cmd/check"
 	"github.com/alex123012/gitdeps/cmd/common"
 	"github.com/alex123012/gitdeps/cmd/config"
@@ -81,6 +83,7 @@ func init() {
 	rootCmd.AddCommand(
 		config.NewCmd(),
 		webhook.NewCmd(),
+		cert.NewCmd(),
 		check.NewCmd(),
 		version.NewCmd(),
 	)
@@ -113,7 +116,16 @@ func initConfig() {
 	viper.SetDefault("webhook_conf.webhook.metadata.namespace", "validation-webhook")
 	viper.SetDefault("webhook_conf.webhook.rules", rule)
 	viper.SetDefault("webhook_conf.webhook.sideEffects", "None")
-	viper.SetDefault("webhook_conf.webhook.admissionReviewVersions", "v1")
+	viper.SetDefault("webhook_conf.webhook.admissionReviewVersions", []string{"v1", "v1beta1"})
+	viper.SetDefault("webhook_conf.match_conditions", "auto")
+	viper.SetDefault("webhook_conf.registration.lease_duration", 15*time.Second)
+	viper.SetDefault("webhook_conf.registration.renew_deadline", 10*time.Second)
+	viper.SetDefault("webhook_conf.registration.retry_period", 2*time.Second)
+	viper.SetDefault("webhook_conf.tls.key_type", "rsa")
+	viper.SetDefault("webhook_conf.tls.validity", 365*24*time.Hour)
+	viper.SetDefault("webhook_conf.tls.rotation.check_interval", time.Hour)
+	viper.SetDefault("webhook_conf.tls.rotation.renew_before", 30*24*time.Hour)
+	viper.SetDefault("webhook_conf.tls.rotation.ca_renew_before", 90*24*time.Hour)
 
 	viper.AutomaticEnv()
 
@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/webhook"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	admissionPolicyAPIVersion = "v1"
+	applyAdmissionPolicy      bool
+)
+
+func NewAdmissionPolicyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate-admission-policy",
+		Short: "ValidatingAdmissionPolicy that requires pipeline url annotation from allowed hosts",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			webhookConf := common.Config.WebhookConf
+			allowedHosts, err := webhook.AllowedHosts(*common.Config)
+			if err != nil {
+				return err
+			}
+
+			policy, err := webhook.ValidatingAdmissionPolicy(webhookConf, allowedHosts, admissionPolicyAPIVersion)
+			if err != nil {
+				return err
+			}
+			binding, err := webhook.ValidatingAdmissionPolicyBinding(webhookConf, admissionPolicyAPIVersion)
+			if err != nil {
+				return err
+			}
+			objects := []*unstructured.Unstructured{policy, binding}
+
+			if !applyAdmissionPolicy {
+				return webhook.PrintManifests(os.Stdout, []runtime.Object{policy, binding}, output)
+			}
+
+			config, err := GenerateNewConfig(local)
+			if err != nil {
+				return err
+			}
+			client, err := dynamic.NewForConfig(config)
+			if err != nil {
+				return err
+			}
+			force := true
+			for _, object := range objects {
+				data, err := json.Marshal(object)
+				if err != nil {
+					return err
+				}
+				resource, err := webhook.AdmissionPolicyResource(object)
+				if err != nil {
+					return err
+				}
+				hclog.L().Info("Applying "+object.GetKind(), "name", object.GetName())
+				_, err = client.Resource(resource).Patch(cmd.Context(), object.GetName(), types.ApplyPatchType, data,
+					metav1.PatchOptions{FieldManager: webhook.FieldManager, Force: &force})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&admissionPolicyAPIVersion, "api-version", admissionPolicyAPIVersion,
+		"ValidatingAdmissionPolicy api version: "+strings.Join(webhook.AdmissionPolicyAPIVersions, " or "))
+	cmd.Flags().BoolVar(&applyAdmissionPolicy, "apply", false, "Apply the policy and its binding to the cluster instead of printing them")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format: yaml or json")
+	k8sCmdConfigFlags(cmd)
+	return cmd
+}
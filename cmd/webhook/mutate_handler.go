@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/gitlab"
+	"github.com/alex123012/gitdeps/pkg/webhook"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// MutateVerifiedObject stamps verification metadata onto objects
+// that pass the check. Objects that fail it are left untouched
+// and are denied by the validating webhook.
+func MutateVerifiedObject(w http.ResponseWriter, r *http.Request) {
+
+	deserializer := codecs.UniversalDeserializer()
+	admissionReviewRequest, err := GetAdmissionRequest(r, deserializer)
+	if err != nil {
+		ReturnError(w, 400,
+			fmt.Sprintf("error getting admission review from request: %v", err),
+		)
+		return
+	}
+
+	response := &admissionv1.AdmissionResponse{
+		Allowed: true,
+		UID:     admissionReviewRequest.Request.UID,
+	}
+	if admissionReviewRequest.Request.Operation == admissionv1.Delete {
+		WriteAdmissionResponse(w, admissionReviewRequest, response)
+		return
+	}
+
+	object, err := GetAdmissionObject(admissionReviewRequest.Request.Object.Raw, deserializer)
+	if err != nil {
+		ReturnError(w, 500,
+			fmt.Sprintf("error decoding raw resource object: %v", err),
+		)
+		return
+	}
+
+	annotations := object.GetAnnotations()
+	mutatingWebhook := webhook.MutatingWebhook(common.Config.WebhookConf)
+	policy, enforced := webhook.MatchingPolicy(common.Config.WebhookConf, []string{mutatingWebhook.Name}, admissionReviewRequest.Request.Namespace)
+	if !enforced || !webhook.PolicySelects(policy, object.GetLabels(), annotations) {
+		WriteAdmissionResponse(w, admissionReviewRequest, response)
+		return
+	}
+
+	oldObject, err := GetAdmissionOldObject(admissionReviewRequest.Request, deserializer)
+	if err != nil {
+		ReturnError(w, 500,
+			fmt.Sprintf("error decoding raw old resource object: %v", err),
+		)
+		return
+	}
+	if webhook.SkipReason(common.Config.WebhookConf, admissionReviewRequest.Request, object, oldObject) != "" {
+		WriteAdmissionResponse(w, admissionReviewRequest, response)
+		return
+	}
+
+	// objects without the pipeline are denied by the validating webhook
+	pipelineUrl, ok := annotations[webhook.PipelineURLAnnotation]
+	if !ok || pipelineUrl == "" {
+		WriteAdmissionResponse(w, admissionReviewRequest, response)
+		return
+	}
+
+	verification, err := gitlab.VerifyPipelineCached(pipelineUrl, verifyOptions(policy, object))
+	if err != nil {
+		ReturnError(w, 500,
+			fmt.Sprintf("error validating resource from gitlab api: %v", err),
+		)
+		return
+	}
+
+	if verification.Allowed {
+		policyName := common.Config.WebhookConf.Webhook.Name
+		if policy != nil {
+			policyName = policy.Name
+		}
+		patch, err := webhook.AnnotationsPatch(annotations,
+			webhook.VerificationAnnotations(verification, policyName, time.Now()),
+		)
+		if err != nil {
+			ReturnError(w, 500,
+				fmt.Sprintf("error creating annotations patch: %v", err),
+			)
+			return
+		}
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch = patch
+		response.PatchType = &patchType
+	}
+
+	WriteAdmissionResponse(w, admissionReviewRequest, response)
+}
@@ -0,0 +1,237 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/alex123012/gitdeps/pkg/webhook"
+	"github.com/hashicorp/go-hclog"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	coordinationTyped "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// removeTimeout limits removal of the webhook configurations on shutdown
+	removeTimeout = 30 * time.Second
+	// MemberLabel marks member Leases of the replicas with the registration Lease name
+	MemberLabel = "gitdeps.io/registration"
+)
+
+// RunRegistration applies webhook configurations while this replica holds the registration Lease.
+// Every replica keeps its own member Lease too, on shutdown the replica deletes it
+// and removes the configurations if no member Lease of another replica is left.
+// caBundle is called every time the configurations are applied.
+func RunRegistration(ctx context.Context, restConfig *rest.Config, webhookConf config.WebHookConf, caBundle func(context.Context) (*bytes.Buffer, error)) error {
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	identity := podName()
+	namespace := podNamespace(webhookConf)
+	registration := webhookConf.Registration
+	leaseName := registration.LeaseName
+	if leaseName == "" {
+		leaseName = webhookConf.Metadata.Name
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock,
+		namespace, leaseName,
+		client.CoreV1(), client.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		return err
+	}
+
+	logger := hclog.L().Named("registration")
+	leases := client.CoordinationV1().Leases(namespace)
+	member := memberLease(leaseName, identity, registration.LeaseDuration)
+	if err := renewMember(ctx, leases, member); err != nil {
+		return fmt.Errorf("failed to create member lease: %w", err)
+	}
+	go func() {
+		ticker := time.NewTicker(registration.RetryPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := renewMember(ctx, leases, member); err != nil && ctx.Err() == nil {
+				logger.Error(fmt.Sprintf("failed to renew member lease: %v", err))
+			}
+		}
+	}()
+
+	for {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   registration.LeaseDuration,
+			RenewDeadline:   registration.RenewDeadline,
+			RetryPeriod:     registration.RetryPeriod,
+			Name:            leaseName,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					logger.Info("Started leading, applying webhook configurations", "identity", identity)
+					bundle, err := caBundle(ctx)
+					if err == nil {
+						err = ApplyWebhookConf(ctx, restConfig, webhookConf, bundle)
+					}
+					if err != nil {
+						logger.Error(fmt.Sprintf("failed to apply webhook configurations: %v", err))
+					}
+				},
+				OnStoppedLeading: func() {
+					logger.Info("Stopped leading", "identity", identity)
+				},
+				OnNewLeader: func(current string) {
+					if current != identity {
+						logger.Info("Webhook configurations are managed by another replica", "leader", current)
+					}
+				},
+			},
+		})
+		if ctx.Err() != nil {
+			break
+		}
+		// lease was lost, join the election again
+	}
+
+	removeCtx, cancel := context.WithTimeout(context.Background(), removeTimeout)
+	defer cancel()
+	// the member Lease is deleted before others are listed, so of replicas
+	// shutting down at the same time at least the last one sees no other members
+	err = leases.Delete(removeCtx, member.Name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete member lease, keeping webhook configurations: %w", err)
+	}
+	replicas, err := otherMembers(removeCtx, leases, leaseName, identity, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to check other webhook replicas, keeping webhook configurations: %w", err)
+	}
+	if replicas > 0 {
+		logger.Info("Other webhook replicas are running, keeping webhook configurations", "replicas", replicas)
+		return nil
+	}
+	logger.Info("Last webhook replica is shutting down, removing webhook configurations")
+	err = RemoveWebhookConf(removeCtx, restConfig, webhookConf, false)
+	if errors.IsNotFound(err) {
+		// already removed on uninstall or by another replica
+		return nil
+	}
+	return err
+}
+
+// memberLease returns Lease that marks the replica as running
+func memberLease(leaseName, identity string, duration time.Duration) *coordinationv1.Lease {
+	seconds := int32(duration.Seconds())
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   fmt.Sprintf("%s-%s", leaseName, identity),
+			Labels: map[string]string{MemberLabel: leaseName},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &identity,
+			LeaseDurationSeconds: &seconds,
+		},
+	}
+}
+
+// renewMember creates the member Lease or updates its renew time
+func renewMember(ctx context.Context, leases coordinationTyped.LeaseInterface, member *coordinationv1.Lease) error {
+	now := metav1.NewMicroTime(time.Now())
+	current, err := leases.Get(ctx, member.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		created := member.DeepCopy()
+		created.Spec.AcquireTime, created.Spec.RenewTime = &now, &now
+		_, err = leases.Create(ctx, created, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	current.Spec.HolderIdentity = member.Spec.HolderIdentity
+	current.Spec.LeaseDurationSeconds = member.Spec.LeaseDurationSeconds
+	current.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, current, metav1.UpdateOptions{})
+	return err
+}
+
+// otherMembers returns number of not expired member Leases of other replicas
+func otherMembers(ctx context.Context, leases coordinationTyped.LeaseInterface, leaseName, identity string, now time.Time) (int, error) {
+	list, err := leases.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{MemberLabel: leaseName}).String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	replicas := 0
+	for _, lease := range list.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || *spec.HolderIdentity == identity || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expires := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+		if now.Before(expires) {
+			replicas++
+		}
+	}
+	return replicas, nil
+}
+
+// RegistrationCABundle returns function that returns caBundle of the running webhook server.
+// Certificates are reloaded from the Secret if it is configured, so the leader
+// applies the bundle renewed by any replica
+func RegistrationCABundle(restConfig *rest.Config, webhookConf config.WebHookConf, certs map[string]*bytes.Buffer) func(context.Context) (*bytes.Buffer, error) {
+	return func(ctx context.Context) (*bytes.Buffer, error) {
+		switch {
+		case webhook.CertManagerEnabled(webhookConf):
+			return webhook.CertManagerCABundle(ctx, restConfig, webhookConf)
+		case webhook.CertificateSecretEnabled(webhookConf):
+			current, found, err := webhook.ReadCertificate(ctx, restConfig, webhookConf)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				return webhook.CABundle(current), nil
+			}
+		}
+		if certs == nil {
+			hclog.L().Warn("CA of the serving certificate is unknown, caBundle is not applied")
+			return nil, nil
+		}
+		return webhook.CABundle(certs), nil
+	}
+}
+
+func podName() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+func podNamespace(webhookConf config.WebHookConf) string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if service := webhookConf.Webhook.ClientConfig.Service; service != nil && service.Namespace != "" {
+		return service.Namespace
+	}
+	return "default"
+}
@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOtherMembers(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		members map[string]time.Time
+		want    int
+	}{
+		{name: "only this replica", members: map[string]time.Time{"pod-a": now}, want: 0},
+		{name: "running replica", members: map[string]time.Time{"pod-a": now, "pod-b": now.Add(-5 * time.Second)}, want: 1},
+		{name: "expired replica", members: map[string]time.Time{"pod-a": now, "pod-b": now.Add(-time.Minute)}, want: 0},
+		{name: "no members", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			leases := fake.NewSimpleClientset().CoordinationV1().Leases("default")
+			for identity, renewed := range tt.members {
+				lease := memberLease("gitdeps", identity, 15*time.Second)
+				renewTime := metav1.NewMicroTime(renewed)
+				lease.Spec.RenewTime = &renewTime
+				if _, err := leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// leases of another registration are not counted
+			other := memberLease("other", "pod-c", 15*time.Second)
+			renewTime := metav1.NewMicroTime(now)
+			other.Spec.RenewTime = &renewTime
+			if _, err := leases.Create(ctx, other, metav1.CreateOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := otherMembers(ctx, leases, "gitdeps", "pod-a", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("otherMembers() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
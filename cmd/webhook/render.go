@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/alex123012/gitdeps/pkg/webhook"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	dryRun      bool
+	diff        bool
+	output      = "yaml"
+	withService bool
+	withSecret  bool
+	withRBAC    bool
+)
+
+func renderCmdFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print manifests instead of applying them")
+	cmd.Flags().BoolVar(&diff, "diff", false, "Show difference between the live and the desired webhook configuration")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Output format for --dry-run: yaml or json")
+	cmd.Flags().BoolVar(&withService, "with-service", false, "Include webhook Service in --dry-run output")
+	cmd.Flags().BoolVar(&withSecret, "with-secret", false, "Include certificates Secret in --dry-run output")
+	cmd.Flags().BoolVar(&withRBAC, "with-rbac", false, "Include ServiceAccount and RBAC in --dry-run output")
+}
+
+// renderNeedsCluster reports whether rendering has to read anything from the cluster
+func renderNeedsCluster(webhookConf config.WebHookConf) bool {
+	if diff {
+		return true
+	}
+	if webhook.CertManagerEnabled(webhookConf) {
+		return webhookConf.Tls.CertManager.CASecret.Name != ""
+	}
+	return webhook.CertificateSecretEnabled(webhookConf)
+}
+
+// PrepareWebhookConf returns webhook config with caBundle source applied,
+// the caBundle and certificates if they are managed by gitdeps.
+// When readOnly is set, certificates Secret is only read and new certificates
+// are generated locally if it doesn't exist, except for --diff
+// where no caBundle is returned, so the live one is kept.
+func PrepareWebhookConf(ctx context.Context, config *rest.Config, webhookConf config.WebHookConf, readOnly bool) (config.WebHookConf, *bytes.Buffer, map[string]*bytes.Buffer, error) {
+	if webhook.CertManagerEnabled(webhookConf) {
+		caBundle, err := webhook.CertManagerCABundle(ctx, config, webhookConf)
+		if err != nil {
+			return webhookConf, nil, nil, err
+		}
+		if caBundle == nil {
+			webhookConf.Metadata = webhook.CertManagerMetadata(webhookConf)
+		}
+		return webhookConf, caBundle, nil, nil
+	}
+
+	if !readOnly {
+		caMap, err := GetCertificate(ctx, config)
+		if err != nil {
+			return webhookConf, nil, nil, err
+		}
+		return webhookConf, webhook.CABundle(caMap), caMap, nil
+	}
+
+	if webhook.CertificateSecretEnabled(webhookConf) {
+		caMap, found, err := webhook.ReadCertificate(ctx, config, webhookConf)
+		if err != nil {
+			return webhookConf, nil, nil, err
+		}
+		if found {
+			return webhookConf, webhook.CABundle(caMap), caMap, nil
+		}
+	}
+	if diff {
+		// a generated CA would always differ from the live one
+		hclog.L().Warn("Certificates are not stored in the cluster, live caBundle is kept in the diff")
+		return webhookConf, nil, nil, nil
+	}
+	if !withSecret {
+		hclog.L().Warn("Rendered caBundle is of a newly generated CA that is not stored anywhere, use --with-secret to render its Secret too")
+	}
+	caMap, err := webhook.GenerateCertificate(webhookConf, false)
+	if err != nil {
+		return webhookConf, nil, nil, err
+	}
+	return webhookConf, webhook.CABundle(caMap), caMap, nil
+}
+
+// WebhookConfigurations returns validating and, if enabled, mutating webhook configurations,
+// matchConditions from policies are set if they are enabled
+func WebhookConfigurations(webhookConf config.WebHookConf, caBundle *bytes.Buffer, matchConditions bool) ([]runtime.Object, error) {
+	objects := []runtime.Object{webhook.ValidatingWebhookConfiguration(caBundle, webhookConf)}
+	if webhookConf.Mutating.Enabled {
+		objects = append(objects, webhook.MutatingWebhookConfiguration(caBundle, webhookConf))
+	}
+	if !matchConditions {
+		return objects, nil
+	}
+	for i := range objects {
+		object, err := webhook.WithMatchConditions(objects[i], webhookConf)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = object
+	}
+	return objects, nil
+}
+
+// RenderWebhookConf prints webhook configurations and optional
+// Service, Secret and RBAC manifests
+func RenderWebhookConf(webhookConf config.WebHookConf, caBundle *bytes.Buffer, certs map[string]*bytes.Buffer, matchConditions bool) error {
+	objects, err := WebhookConfigurations(webhookConf, caBundle, matchConditions)
+	if err != nil {
+		return err
+	}
+	if withService {
+		service, err := webhook.ServiceManifest(webhookConf)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, service)
+	}
+	if withSecret {
+		if certs == nil {
+			hclog.L().Warn("Certificates are not managed by gitdeps, Secret is not rendered")
+		} else {
+			if webhookConf.Tls.Secret.Name == "" {
+				webhookConf.Tls.Secret.Name = fmt.Sprintf("%s-tls", config.ApplicationName)
+			}
+			objects = append(objects, webhook.CertificateSecret(webhookConf, certs))
+		}
+	}
+	if withRBAC {
+		rbac, err := webhook.RBACManifests(webhookConf)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, rbac...)
+	}
+	return webhook.PrintManifests(os.Stdout, objects, output)
+}
+
+// DiffWebhookConf prints difference between the live webhook configurations and the desired ones.
+// Live configurations are read as unstructured objects, so fields unknown to the client are compared too.
+// Defaults the apiserver sets are filled in the desired configurations, so they are not reported
+func DiffWebhookConf(ctx context.Context, config *rest.Config, webhookConf config.WebHookConf, caBundle *bytes.Buffer, matchConditions bool) error {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	objects, err := WebhookConfigurations(webhookConf, caBundle, matchConditions)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+		if err != nil {
+			return err
+		}
+		desired := &unstructured.Unstructured{Object: content}
+		if err := webhook.SetServerDefaults(desired); err != nil {
+			return err
+		}
+		resource := admissionregistrationv1.SchemeGroupVersion.WithResource(strings.ToLower(desired.GetKind()) + "s")
+
+		var live runtime.Object
+		result, err := client.Resource(resource).Get(ctx, desired.GetName(), metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+		case err != nil:
+			return err
+		default:
+			if caBundle == nil {
+				// caBundle is injected by cert-manager or is not known locally
+				if err := copyCABundle(result, desired); err != nil {
+					return err
+				}
+			}
+			live = result
+		}
+		if err := printDiff(desired.GetKind()+"/"+desired.GetName(), live, desired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyCABundle copies caBundle of the webhooks with the same names from live to desired
+func copyCABundle(live, desired *unstructured.Unstructured) error {
+	liveWebhooks, _, err := unstructured.NestedSlice(live.Object, "webhooks")
+	if err != nil {
+		return err
+	}
+	caBundles := make(map[string]interface{}, len(liveWebhooks))
+	for _, item := range liveWebhooks {
+		if webhook, ok := item.(map[string]interface{}); ok {
+			name, _, _ := unstructured.NestedString(webhook, "name")
+			if caBundle, found, _ := unstructured.NestedFieldNoCopy(webhook, "clientConfig", "caBundle"); found {
+				caBundles[name] = caBundle
+			}
+		}
+	}
+
+	webhooks, _, err := unstructured.NestedSlice(desired.Object, "webhooks")
+	if err != nil {
+		return err
+	}
+	for _, item := range webhooks {
+		webhook, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(webhook, "name")
+		if caBundle, ok := caBundles[name]; ok {
+			if err := unstructured.SetNestedField(webhook, caBundle, "clientConfig", "caBundle"); err != nil {
+				return err
+			}
+		}
+	}
+	return unstructured.SetNestedSlice(desired.Object, webhooks, "webhooks")
+}
+
+func printDiff(name string, live, desired runtime.Object) error {
+	res, err := webhook.DiffManifests(name, live, desired)
+	if err != nil {
+		return err
+	}
+	if res == "" {
+		hclog.L().Info("No differences", "object", name)
+		return nil
+	}
+	fmt.Print(res)
+	return nil
+}
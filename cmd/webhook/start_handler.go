@@ -5,13 +5,17 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"path"
+	"time"
 
 	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/alex123012/gitdeps/pkg/freeze"
 	"github.com/alex123012/gitdeps/pkg/gitlab"
 	"github.com/alex123012/gitdeps/pkg/webhook"
 	"github.com/hashicorp/go-hclog"
@@ -21,10 +25,14 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 var (
 	port   int
+	dev    bool
+	devURL string
 	codecs serializer.CodecFactory = serializer.NewCodecFactory(runtime.NewScheme())
 	logger *log.Logger             = hclog.L().StandardLogger(&hclog.StandardLoggerOptions{
 		InferLevels:              true,
@@ -32,6 +40,9 @@ var (
 	})
 )
 
+// clusterClient is used by handlers to look up objects in the cluster
+var clusterClient kubernetes.Interface
+
 func NewWebHookCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "start-handler",
@@ -50,28 +61,66 @@ func NewWebHookCmd() *cobra.Command {
 	}
 
 	cmd.Flags().IntVar(&port, "port", port, "port to expose")
+	cmd.Flags().BoolVar(&dev, "dev", false, "Run outside of the cluster: generate local certificate, register url webhook configuration using local kubeconfig and remove it on shutdown")
+	cmd.Flags().StringVar(&devURL, "dev-url", "", "Url the apiserver reaches the webhook server at in --dev mode, e.g. https://172.17.0.1:8443")
+	k8sCmdConfigFlags(cmd)
 	return cmd
 }
 
 // https://github.com/cnych/admission-webhook-example/blob/master/webhook.go
 func RunWebHook(ctx context.Context, fromFile bool) error {
 	fmt.Println("Starting webhook server")
-	var cert tls.Certificate
+	var keypair *webhook.Keypair
 	var err error
 	var caMap map[string]*bytes.Buffer
-	if fromFile {
-		cfg := &common.Config.WebhookConf
-		certsPath := cfg.Tls.Path
-		certificateFile := path.Join(certsPath, cfg.Tls.CertFile)
-		keyFile := path.Join(certsPath, cfg.Tls.KeyFile)
-
-		cert, err = tls.LoadX509KeyPair(certificateFile, keyFile)
+	if dev {
+		if devURL == "" {
+			return fmt.Errorf("--dev-url is required in --dev mode")
+		}
+		common.Config.WebhookConf, err = webhook.DevWebhookConf(common.Config.WebhookConf, devURL)
+		if err != nil {
+			return err
+		}
+		local = true
+		fromFile = false
+	}
+	if webhook.CertManagerEnabled(common.Config.WebhookConf) {
+		certificateFile, keyFile := certificateFiles()
+		keypair, err = webhook.KeypairFromFiles(certificateFile, keyFile)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := webhook.WatchKeypair(ctx, keypair, certificateFile, keyFile); err != nil {
+				hclog.L().Error(fmt.Sprintf("failed to watch certificate files: %v", err))
+			}
+		}()
+	} else if fromFile && !webhook.CertificateSecretEnabled(common.Config.WebhookConf) {
+		keypair, err = webhook.KeypairFromFiles(certificateFiles())
 	} else {
-		caMap, err = webhook.GenerateCertificate(common.Config.WebhookConf, fromFile)
+		var config *rest.Config
+		if webhook.CertificateSecretEnabled(common.Config.WebhookConf) || common.Config.WebhookConf.Tls.Rotation.Enabled {
+			config, err = GenerateNewConfig(local)
+			if err != nil {
+				return err
+			}
+		}
+		caMap, err = GetCertificate(ctx, config)
+		if err != nil {
+			return err
+		}
+		keypair, err = webhook.NewKeypair(caMap["cert"].Bytes(), caMap["key"].Bytes())
 		if err != nil {
 			return err
 		}
-		cert, err = tls.X509KeyPair(caMap["cert"].Bytes(), caMap["key"].Bytes())
+
+		if common.Config.WebhookConf.Tls.Rotation.Enabled {
+			rotator, err := webhook.NewCertificateRotator(config, common.Config.WebhookConf, caMap, keypair)
+			if err != nil {
+				return err
+			}
+			go rotator.Run(ctx)
+		}
 	}
 
 	if err != nil {
@@ -79,16 +128,92 @@ func RunWebHook(ctx context.Context, fromFile bool) error {
 	}
 
 	if port == 0 {
-		port = int(*common.Config.WebhookConf.Webhook.ClientConfig.Service.Port)
+		port, err = webhook.ServerPort(common.Config.WebhookConf)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := webhook.CheckClusterLookup(common.Config.WebhookConf); err != nil {
+		return err
+	}
+	if webhook.ClusterLookupEnabled(common.Config.WebhookConf) {
+		clusterConfig, err := GenerateNewConfig(local)
+		if err != nil {
+			return err
+		}
+		clusterClient, err = kubernetes.NewForConfig(clusterConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if common.Config.WebhookConf.Registration.Enabled && !dev {
+		config, err := GenerateNewConfig(local)
+		if err != nil {
+			return err
+		}
+		registrationConf := common.Config.WebhookConf
+		if webhook.CertManagerEnabled(registrationConf) && registrationConf.Tls.CertManager.CASecret.Name == "" {
+			registrationConf.Metadata = webhook.CertManagerMetadata(registrationConf)
+		}
+		// registration stops when the server returns, including when it fails to start,
+		// so a replica that doesn't serve doesn't keep the configurations registered
+		registrationCtx, stopRegistration := context.WithCancel(ctx)
+		registered := make(chan struct{})
+		go func() {
+			defer close(registered)
+			err := RunRegistration(registrationCtx, config, registrationConf, RegistrationCABundle(config, registrationConf, caMap))
+			if err != nil {
+				hclog.L().Error(fmt.Sprintf("webhook registration failed: %v", err))
+			}
+		}()
+		// wait for the last replica to remove configurations on shutdown
+		defer func() {
+			stopRegistration()
+			<-registered
+		}()
+	}
+
+	if dev {
+		config, err := GenerateNewConfig(local)
+		if err != nil {
+			return err
+		}
+		hclog.L().Info("Registering webhook configuration", "url", *common.Config.WebhookConf.Webhook.ClientConfig.URL)
+		if err := ApplyWebhookConf(ctx, config, common.Config.WebhookConf, webhook.CABundle(caMap)); err != nil {
+			return err
+		}
+		defer func() {
+			hclog.L().Info("Removing webhook configuration")
+			if err := RemoveWebhookConf(context.Background(), config, common.Config.WebhookConf, false); err != nil {
+				hclog.L().Error(fmt.Sprintf("failed to remove webhook configuration: %v", err))
+			}
+		}()
 	}
 
 	// define http server and server handler
 	mux := http.NewServeMux()
-	mux.HandleFunc("/validate", ValidateDeployingBranch)
+	mutatePath := webhook.ClientConfigPath(webhook.MutatingWebhook(common.Config.WebhookConf).ClientConfig)
+	mux.HandleFunc(webhook.HealthzPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(mutatePath, MutateVerifiedObject)
+	for webhookPath, names := range webhook.WebhookPaths(common.Config.WebhookConf) {
+		if webhookPath == mutatePath {
+			hclog.L().Warn("Validating webhooks use the mutating webhook path, skipping", "path", webhookPath, "webhooks", names)
+			continue
+		}
+		hclog.L().Info("Serving validating webhooks", "path", webhookPath, "webhooks", names)
+		if len(names) > 1 {
+			hclog.L().Warn("Webhooks share the path, policies bound to any of them are applied", "path", webhookPath, "webhooks", names)
+		}
+		mux.HandleFunc(webhookPath, ValidateHandler(names))
+	}
 	server := http.Server{
 		Addr: fmt.Sprintf(":%d", port),
 		TLSConfig: &tls.Config{
-			Certificates: []tls.Certificate{cert},
+			GetCertificate: keypair.GetCertificate,
 		},
 		ErrorLog: logger,
 		Handler:  mux,
@@ -100,10 +225,32 @@ func RunWebHook(ctx context.Context, fromFile bool) error {
 		server.Shutdown(context.Background())
 	}()
 
-	return server.ListenAndServeTLS("", "")
+	err = server.ListenAndServeTLS("", "")
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func certificateFiles() (string, string) {
+	cfg := &common.Config.WebhookConf
+	certsPath := cfg.Tls.Path
+	return path.Join(certsPath, cfg.Tls.CertFile), path.Join(certsPath, cfg.Tls.KeyFile)
+}
+
+// ValidateHandler returns handler that validates requests sent by the named webhooks
+func ValidateHandler(webhooks []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hclog.L().Debug("Validating request", "path", r.URL.Path, "webhooks", webhooks)
+		validateDeployingBranch(w, r, webhooks)
+	}
 }
 
 func ValidateDeployingBranch(w http.ResponseWriter, r *http.Request) {
+	validateDeployingBranch(w, r, nil)
+}
+
+func validateDeployingBranch(w http.ResponseWriter, r *http.Request, webhooks []string) {
 
 	deserializer := codecs.UniversalDeserializer()
 	admissionReviewRequest, err := GetAdmissionRequest(r, deserializer)
@@ -121,9 +268,8 @@ func ValidateDeployingBranch(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	rawRequest := admissionReviewRequest.Request.Object.Raw
-	object := unstructured.Unstructured{}
-	if _, _, err := deserializer.Decode(rawRequest, nil, &object); err != nil {
+	object, err := GetAdmissionObject(admissionReviewRequest.Request.Object.Raw, deserializer)
+	if err != nil {
 		ReturnError(w, 500,
 			fmt.Sprintf("error decoding raw resource object: %v", err),
 		)
@@ -137,9 +283,45 @@ func ValidateDeployingBranch(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 	annotations := object.GetAnnotations()
-	pipelineUrl := annotations["gitlab.ci.werf.io/pipeline-url"]
-	allowValidation, err := gitlab.TargetHaveAllCommitsFromDefault(pipelineUrl)
-	fmt.Println(allowValidation)
+	policy, enforced := webhook.MatchingPolicy(common.Config.WebhookConf, webhooks, admissionReviewRequest.Request.Namespace)
+	if !enforced || !webhook.PolicySelects(policy, object.GetLabels(), annotations) {
+		hclog.L().Debug("Object is not selected by any policy", "namespace", admissionReviewRequest.Request.Namespace, "name", admissionReviewRequest.Request.Name)
+		WriteAdmissionResponse(w, admissionReviewRequest, &admissionv1.AdmissionResponse{
+			Allowed: true,
+			UID:     admissionReviewRequest.Request.UID,
+		})
+		return
+	}
+
+	oldObject, err := GetAdmissionOldObject(admissionReviewRequest.Request, deserializer)
+	if err != nil {
+		ReturnError(w, 500,
+			fmt.Sprintf("error decoding raw old resource object: %v", err),
+		)
+		return
+	}
+	if reason := webhook.SkipReason(common.Config.WebhookConf, admissionReviewRequest.Request, object, oldObject); reason != "" {
+		hclog.L().Debug("Skipping check", "namespace", admissionReviewRequest.Request.Namespace, "name", admissionReviewRequest.Request.Name, "reason", reason)
+		WriteAdmissionResponse(w, admissionReviewRequest, &admissionv1.AdmissionResponse{
+			Allowed: true,
+			Result:  &metav1.Status{Message: reason},
+			UID:     admissionReviewRequest.Request.UID,
+		})
+		return
+	}
+
+	pipelineUrl := annotations[webhook.PipelineURLAnnotation]
+	if pipelineUrl == "" {
+		message := fmt.Sprintf("%s annotation is required", webhook.PipelineURLAnnotation)
+		WriteAdmissionResponse(w, admissionReviewRequest, &admissionv1.AdmissionResponse{
+			Allowed:  false,
+			Result:   &metav1.Status{Message: message, Status: "error", Reason: webhook.DeniedReason, Code: webhook.DeniedCode},
+			Warnings: []string{message},
+			UID:      admissionReviewRequest.Request.UID,
+		})
+		return
+	}
+	verification, err := gitlab.VerifyPipelineCached(pipelineUrl, verifyOptions(policy, object))
 	if err != nil {
 		ReturnError(w, 500,
 			fmt.Sprintf("error validating resource from gitlab api: %v", err),
@@ -147,31 +329,237 @@ func ValidateDeployingBranch(w http.ResponseWriter, r *http.Request) {
 
 		return
 	}
+	allowValidation := verification.Allowed
 
 	var message, status string
 	var warnings []string
+	var auditAnnotations map[string]string
 	if allowValidation {
 		message = "All good"
 		status = "success"
+		if verification.BehindCommits > 0 {
+			warnings = []string{fmt.Sprintf("%s is %d commits behind %s", verification.TargetRef, verification.BehindCommits, verification.BaseRef)}
+		}
 	} else {
 		message = "Deploying branch don't have commits from default branch"
+		if verification.Reason != "" {
+			message = verification.Reason
+		}
 		status = "error"
 		warnings = []string{message}
 	}
 
-	admissionReviewResponse := admissionv1.AdmissionReview{
-		Response: &admissionv1.AdmissionResponse{
-			Allowed: allowValidation,
-			Result: &metav1.Status{
-				Message: message,
-				Status:  status,
-				Reason:  metav1.StatusReasonConflict,
-			},
-			Warnings: warnings,
-			UID:      admissionReviewRequest.Request.UID,
-		},
+	if allowValidation && (policy == nil || !policy.FreezeExempt) {
+		reason, err := freezeReason(common.Config.WebhookConf, pipelineUrl, time.Now())
+		if err != nil {
+			ReturnError(w, 500,
+				fmt.Sprintf("error checking freeze windows: %v", err),
+			)
+			return
+		}
+
+		override := annotations[webhook.FreezeOverrideAnnotation]
+		overridden := webhook.OverrideApplies(override, pipelineUrl, verification.TargetSHA)
+		if reason != "" && override != "" && !overridden {
+			warnings = append(warnings, fmt.Sprintf("%s annotation %q is ignored, it must be the pipeline url or the commit sha of this deploy", webhook.FreezeOverrideAnnotation, override))
+		}
+		switch {
+		case reason == "":
+		case overridden && policy != nil && policy.AllowFreezeOverride:
+			auditLog(admissionReviewRequest.Request, "Freeze overridden by annotation",
+				"target", pipelineUrl,
+				"reason", reason,
+				webhook.FreezeOverrideAnnotation, override,
+			)
+			warnings = append(warnings, fmt.Sprintf("freeze overridden by %s annotation: %s", webhook.FreezeOverrideAnnotation, reason))
+			auditAnnotations = map[string]string{"freeze-override": override}
+		default:
+			allowValidation = false
+			message = reason
+			if policy != nil && policy.AllowFreezeOverride {
+				message = fmt.Sprintf("%s, set %s annotation to the pipeline url or the commit sha of this deploy for emergency deploys", reason, webhook.FreezeOverrideAnnotation)
+			}
+			status = "error"
+			warnings = []string{message}
+		}
+	}
+
+	if allowValidation {
+		reason, err := policyChecks(r.Context(), policy, pipelineUrl, verification, admissionReviewRequest.Request.Namespace)
+		if err != nil {
+			ReturnError(w, 500,
+				fmt.Sprintf("error validating resource from gitlab api: %v", err),
+			)
+			return
+		}
+		if reason != "" {
+			allowValidation = false
+			message = reason
+			status = "error"
+			warnings = []string{message}
+		}
+	}
+
+	if deployedPipelineUrl := webhook.DeployedPipelineURL(oldObject, object); allowValidation && deployedPipelineUrl != "" {
+		reason, err := gitlab.CheckRollback(deployedPipelineUrl, pipelineUrl)
+		var unknownDeployment *gitlab.UnknownDeploymentError
+		if errors.As(err, &unknownDeployment) {
+			// treated as no previous deployment, so the object can still be updated
+			hclog.L().Warn("Skipping rollback check", "namespace", admissionReviewRequest.Request.Namespace, "name", admissionReviewRequest.Request.Name, "error", err)
+			warnings = append(warnings, fmt.Sprintf("rollback is not checked: %v", err))
+			reason, err = "", nil
+		}
+		if err != nil {
+			ReturnError(w, 500,
+				fmt.Sprintf("error checking rollback from gitlab api: %v", err),
+			)
+			return
+		}
+
+		override := annotations[webhook.AllowRollbackAnnotation]
+		overridden := webhook.OverrideApplies(override, pipelineUrl, verification.TargetSHA)
+		if reason != "" && override != "" && !overridden {
+			warnings = append(warnings, fmt.Sprintf("%s annotation %q is ignored, it must be the pipeline url or the commit sha of this deploy", webhook.AllowRollbackAnnotation, override))
+		}
+		switch {
+		case reason == "":
+		case overridden:
+			auditLog(admissionReviewRequest.Request, "Rollback allowed by annotation",
+				"deployed", deployedPipelineUrl,
+				"target", pipelineUrl,
+				"reason", reason,
+				webhook.AllowRollbackAnnotation, override,
+			)
+			warnings = append(warnings, fmt.Sprintf("rollback allowed by %s annotation: %s", webhook.AllowRollbackAnnotation, reason))
+			if auditAnnotations == nil {
+				auditAnnotations = map[string]string{}
+			}
+			auditAnnotations["allow-rollback"] = override
+		case webhook.RollbackAction(policy) == webhook.RollbackWarn:
+			warnings = append(warnings, reason)
+		default:
+			allowValidation = false
+			message = fmt.Sprintf("Rollback is denied, set %s annotation to the pipeline url or the commit sha of this deploy to allow it: %s", webhook.AllowRollbackAnnotation, reason)
+			status = "error"
+			warnings = append(warnings, message)
+		}
+	}
+
+	result := &metav1.Status{
+		Message: message,
+		Status:  status,
+		Reason:  webhook.DeniedReason,
+	}
+	if !allowValidation {
+		result.Code = webhook.DeniedCode
+	}
+	WriteAdmissionResponse(w, admissionReviewRequest, &admissionv1.AdmissionResponse{
+		Allowed:          allowValidation,
+		Result:           result,
+		Warnings:         warnings,
+		AuditAnnotations: auditAnnotations,
+		UID:              admissionReviewRequest.Request.UID,
+	})
+}
+
+// freezeReason returns why deploys are frozen at now, empty string is returned if they are not
+func freezeReason(WebhookConf config.WebHookConf, pipelineUrl string, now time.Time) (string, error) {
+	windows, err := freeze.ConfiguredWindows(WebhookConf.Freeze)
+	if err != nil {
+		return "", err
+	}
+	if WebhookConf.Freeze.GitLab {
+		gitlabWindows, err := gitlab.GetFreezeWindows(pipelineUrl)
+		if err != nil {
+			return "", err
+		}
+		windows = append(windows, gitlabWindows...)
+	}
+
+	window, end, frozen := freeze.Active(windows, now)
+	if !frozen {
+		return "", nil
+	}
+	if end.IsZero() {
+		return fmt.Sprintf("Deploys are frozen by %s", window.Name), nil
+	}
+	return fmt.Sprintf("Deploys are frozen by %s until %s", window.Name, end.Format(time.RFC3339)), nil
+}
+
+// auditLog records decisions that were overridden by annotations
+func auditLog(request *admissionv1.AdmissionRequest, msg string, args ...interface{}) {
+	args = append([]interface{}{
+		"namespace", request.Namespace,
+		"name", request.Name,
+		"user", request.UserInfo.Username,
+	}, args...)
+	hclog.L().Named("audit").Info(msg, args...)
+}
+
+// verifyOptions returns checks of the default branch lookup required by the policy,
+// the ignored commits and paths of the object component
+func verifyOptions(policy *config.Policy, object *unstructured.Unstructured) gitlab.VerifyOptions {
+	paths := webhook.ComponentPaths(policy, object)
+	if policy == nil {
+		return gitlab.VerifyOptions{IgnoreCommits: common.Config.IgnoreCommits, Paths: paths}
+	}
+	return gitlab.VerifyOptions{
+		RequireHealthyBase: policy.RequireHealthyDefaultBranch,
+		MaxPipelineAge:     policy.MaxPipelineAge,
+		MaxBehindCommits:   policy.MaxBehindCommits,
+		MaxMergeBaseAge:    policy.MaxMergeBaseAge,
+		IgnoreCommits:      common.Config.IgnoreCommits,
+		Paths:              paths,
+	}
+}
+
+// policyChecks runs checks required by the policy in addition to the default branch check,
+// the reason of the first failed check is returned
+func policyChecks(ctx context.Context, policy *config.Policy, pipelineUrl string, verification *gitlab.Verification, namespace string) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+	reason, err := gitlab.CheckPipelineJobs(pipelineUrl, policy.RequireSuccess, policy.RequiredJobs)
+	if err != nil || reason != "" {
+		return reason, err
+	}
+
+	if policy.VerifySubmodules {
+		reason, err := gitlab.CheckSubmodules(pipelineUrl, verification.TargetSHA)
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+
+	if policy.CheckDependencies {
+		reason, err := webhook.CheckDependencies(ctx, clusterClient, pipelineUrl, verification.TargetSHA, namespace)
+		if err != nil || reason != "" {
+			return reason, err
+		}
+	}
+
+	promotion := policy.Promotion
+	switch promotion.Source {
+	case "":
+		return "", nil
+	case webhook.PromotionGitLab:
+		return gitlab.CheckPromotion(pipelineUrl, promotion.Environment, verification.TargetSHA, promotion.Soak, time.Now())
+	case webhook.PromotionCluster:
+		return webhook.CheckClusterPromotion(ctx, clusterClient, promotion, verification.ProjectPath, verification.TargetSHA, time.Now())
+	}
+	return "", fmt.Errorf("not valid promotion source %q of policy %q, use one of [gitlab, cluster]", promotion.Source, policy.Name)
+}
+
+// WriteAdmissionResponse writes response as AdmissionReview
+// with the same version and kind as the request review
+func WriteAdmissionResponse(w http.ResponseWriter, admissionReviewRequest *admissionv1.AdmissionReview, response *admissionv1.AdmissionResponse) {
+	admissionReviewResponse, err := webhook.AdmissionReviewResponse(admissionReviewRequest.GroupVersionKind(), response)
+	if err != nil {
+		ReturnError(w, 500,
+			fmt.Sprintf("error creating admission review response: %v", err),
+		)
+		return
 	}
-	admissionReviewResponse.SetGroupVersionKind(admissionReviewRequest.GroupVersionKind())
 
 	resp, err := json.Marshal(admissionReviewResponse)
 	if err != nil {
@@ -202,15 +590,35 @@ func GetAdmissionRequest(r *http.Request, deserializer runtime.Decoder) (*admiss
 		body = requestData
 	}
 
-	// Decode the request body into
-	admissionReviewRequest := &admissionv1.AdmissionReview{}
-	if _, _, err := deserializer.Decode(body, nil, admissionReviewRequest); err != nil {
+	// Decode the request body into v1 review, v1beta1 reviews are converted
+	admissionReviewRequest, err := webhook.DecodeAdmissionReview(body, deserializer)
+	if err != nil {
 		return nil, err
 	}
+	if admissionReviewRequest.Request == nil {
+		return nil, fmt.Errorf("admission review has no request")
+	}
 
 	return admissionReviewRequest, nil
 }
 
+// GetAdmissionObject decodes raw object from the admission request
+func GetAdmissionObject(rawObject []byte, deserializer runtime.Decoder) (*unstructured.Unstructured, error) {
+	object := &unstructured.Unstructured{}
+	if _, _, err := deserializer.Decode(rawObject, nil, object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// GetAdmissionOldObject decodes the old object of UPDATE requests, nil is returned for other operations
+func GetAdmissionOldObject(request *admissionv1.AdmissionRequest, deserializer runtime.Decoder) (*unstructured.Unstructured, error) {
+	if request.Operation != admissionv1.Update || len(request.OldObject.Raw) == 0 {
+		return nil, nil
+	}
+	return GetAdmissionObject(request.OldObject.Raw, deserializer)
+}
+
 func ReturnError(w http.ResponseWriter, status int, msg string) {
 	// msg := fmt.Sprintf("error getting admission review from request: %v", err)
 	hclog.L().Error(msg)
@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/alex123012/gitdeps/pkg/webhook"
+)
+
+func TestValidateSelfTestWithoutPipeline(t *testing.T) {
+	tests := []struct {
+		name        string
+		policies    []config.Policy
+		wantAllowed bool
+	}{
+		{name: "enforced", wantAllowed: false},
+		{name: "not enforced namespace", policies: []config.Policy{{Namespaces: []string{"production"}}}, wantAllowed: true},
+	}
+	previous := common.Config
+	defer func() { common.Config = previous }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.Config = &config.Config{WebhookConf: config.WebHookConf{Policies: tt.policies}}
+
+			review, err := webhook.SelfTestReview(webhook.SelfTestObject("default", ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := json.Marshal(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			ValidateDeployingBranch(recorder, request)
+
+			result := recorder.Result()
+			data, err := io.ReadAll(result.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.StatusCode != http.StatusOK {
+				t.Fatalf("status = %s: %s", result.Status, data)
+			}
+			response, err := webhook.CheckReviewResponse(review, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.Allowed != tt.wantAllowed {
+				t.Errorf("allowed = %v, want %v", response.Allowed, tt.wantAllowed)
+			}
+			if !response.Allowed && response.Result.Code != webhook.DeniedCode {
+				t.Errorf("denial code = %d, want %d", response.Result.Code, webhook.DeniedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/alex123012/gitdeps/pkg/webhook"
+	"github.com/hashicorp/go-hclog"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	selfTestVia         = "apiserver"
+	selfTestNamespace   = "default"
+	selfTestPipelineURL string
+	selfTestURL         string
+	selfTestInsecure    bool
+)
+
+func NewStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show webhook configurations, caBundle expiry and whether webhook endpoints answer",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			config, err := GenerateNewConfig(local)
+			if err != nil {
+				return err
+			}
+			healthy, err := PrintWebhookStatus(ctx, config, common.Config.WebhookConf)
+			if err != nil {
+				return err
+			}
+			if !healthy {
+				return fmt.Errorf("webhook is not healthy")
+			}
+			return nil
+		},
+	}
+
+	k8sCmdConfigFlags(cmd)
+	return cmd
+}
+
+func NewSelfTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "Send synthetic dry run request to the webhook and check the response",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			object := webhook.SelfTestObject(selfTestNamespace, selfTestPipelineURL)
+			switch selfTestVia {
+			case "apiserver":
+				config, err := GenerateNewConfig(local)
+				if err != nil {
+					return err
+				}
+				return SelfTestViaAPIServer(ctx, config, object)
+			case "direct":
+				return SelfTestDirect(ctx, common.Config.WebhookConf, object)
+			}
+			return fmt.Errorf("not valid --via %q, use one of [apiserver, direct]", selfTestVia)
+		},
+	}
+
+	cmd.Flags().StringVar(&selfTestVia, "via", selfTestVia, "Send request through the apiserver as dry run create or directly to the handler: apiserver or direct")
+	cmd.Flags().StringVarP(&selfTestNamespace, "namespace", "n", selfTestNamespace, "Namespace of the synthetic Deployment")
+	cmd.Flags().StringVar(&selfTestPipelineURL, "pipeline-url", "", "Pipeline url annotation of the synthetic Deployment, without it the webhook is expected to deny the request")
+	cmd.Flags().StringVar(&selfTestURL, "url", "", "Handler url for --via direct, defaults to url clientConfig of the webhook, e.g. https://localhost:8443/validate with port-forward")
+	cmd.Flags().BoolVar(&selfTestInsecure, "insecure", false, "Don't verify handler certificate for --via direct instead of trusting caBundle of the live configuration")
+	k8sCmdConfigFlags(cmd)
+	return cmd
+}
+
+// PrintWebhookStatus prints state of the webhook configurations from config and reports whether they are healthy
+func PrintWebhookStatus(ctx context.Context, restConfig *rest.Config, webhookConf config.WebHookConf) (bool, error) {
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return false, err
+	}
+	name := webhookConf.Metadata.Name
+	healthy := true
+
+	validating, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		fmt.Printf("ValidatingWebhookConfiguration %s: not found\n", name)
+		healthy = false
+	case err != nil:
+		return false, err
+	default:
+		fmt.Printf("ValidatingWebhookConfiguration %s: %s\n", name, describeOwnership(validating.ObjectMeta, webhookConf))
+		for _, w := range validating.Webhooks {
+			healthy = printWebhookStatus(ctx, client, webhookConf, w.Name, w.ClientConfig, w.Rules, w.FailurePolicy) && healthy
+		}
+	}
+
+	if !webhookConf.Mutating.Enabled {
+		return healthy, nil
+	}
+	mutating, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		fmt.Printf("MutatingWebhookConfiguration %s: not found\n", name)
+		healthy = false
+	case err != nil:
+		return false, err
+	default:
+		fmt.Printf("MutatingWebhookConfiguration %s: %s\n", name, describeOwnership(mutating.ObjectMeta, webhookConf))
+		for _, w := range mutating.Webhooks {
+			healthy = printWebhookStatus(ctx, client, webhookConf, w.Name, w.ClientConfig, w.Rules, w.FailurePolicy) && healthy
+		}
+	}
+	return healthy, nil
+}
+
+func printWebhookStatus(ctx context.Context, client kubernetes.Interface, webhookConf config.WebHookConf, name string, clientConfig v1.WebhookClientConfig, rules []v1.RuleWithOperations, failurePolicy *v1.FailurePolicyType) bool {
+	healthy := true
+	policy := "Fail"
+	if failurePolicy != nil {
+		policy = string(*failurePolicy)
+	}
+	fmt.Printf("  Webhook %s\n", name)
+	fmt.Printf("    Client:         %s\n", webhook.DescribeClientConfig(clientConfig))
+	fmt.Printf("    Failure policy: %s\n", policy)
+	fmt.Printf("    Rules:          %s\n", webhook.DescribeRules(rules))
+
+	cas, err := webhook.ParseCertificates(clientConfig.CABundle)
+	if err != nil {
+		fmt.Printf("    caBundle:       not valid: %v\n", err)
+		healthy = false
+	} else {
+		now := time.Now()
+		for _, ca := range cas {
+			state := fmt.Sprintf("expires %s (in %s)", ca.NotAfter.Format(time.RFC3339), ca.NotAfter.Sub(now).Round(time.Hour))
+			if now.After(ca.NotAfter) {
+				state = fmt.Sprintf("expired %s", ca.NotAfter.Format(time.RFC3339))
+				healthy = false
+			}
+			fmt.Printf("    caBundle:       %s %s\n", ca.Subject, state)
+		}
+	}
+
+	cert, dnsName, err := servingCertificate(ctx, webhookConf, clientConfig)
+	switch {
+	case err != nil:
+		fmt.Printf("    Serving cert:   unknown: %v\n", err)
+	case cert == nil:
+		fmt.Printf("    Serving cert:   unknown\n")
+	default:
+		if err := webhook.VerifyServingCertificate(clientConfig.CABundle, cert, dnsName); err != nil {
+			fmt.Printf("    Serving cert:   not trusted by caBundle: %v\n", err)
+			healthy = false
+		} else {
+			fmt.Printf("    Serving cert:   trusted by caBundle for %s, expires %s\n", dnsName, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	if err := webhook.CheckEndpoint(ctx, client, clientConfig); err != nil {
+		fmt.Printf("    Endpoint:       not answering: %v\n", err)
+		healthy = false
+	} else {
+		fmt.Printf("    Endpoint:       ok\n")
+	}
+	return healthy
+}
+
+// servingCertificate returns certificate the webhook server serves and the name the apiserver verifies it for.
+// It is read from the url endpoint or from the certificates Secret, nil is returned if it can't be found
+func servingCertificate(ctx context.Context, webhookConf config.WebHookConf, clientConfig v1.WebhookClientConfig) (*x509.Certificate, string, error) {
+	if clientConfig.URL != nil {
+		webhookURL, err := url.Parse(*clientConfig.URL)
+		if err != nil {
+			return nil, "", err
+		}
+		cert, err := webhook.PeerCertificate(ctx, *clientConfig.URL)
+		return cert, webhookURL.Hostname(), err
+	}
+	service := clientConfig.Service
+	if service == nil || !webhook.CertificateSecretEnabled(webhookConf) {
+		return nil, "", nil
+	}
+	restConfig, err := GenerateNewConfig(local)
+	if err != nil {
+		return nil, "", err
+	}
+	certs, found, err := webhook.ReadCertificate(ctx, restConfig, webhookConf)
+	if err != nil || !found {
+		return nil, "", err
+	}
+	cert, err := webhook.ParseCertificate(certs["cert"].Bytes())
+	return cert, fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace), err
+}
+
+func describeOwnership(meta metav1.ObjectMeta, webhookConf config.WebHookConf) string {
+	if webhook.IsOwned(meta, webhookConf) {
+		return fmt.Sprintf("found, managed by this %s instance", config.ApplicationName)
+	}
+	return fmt.Sprintf("found, not managed by this %s instance", config.ApplicationName)
+}
+
+// SelfTestViaAPIServer creates the object with dry run, so it is sent to the webhooks by the apiserver
+func SelfTestViaAPIServer(ctx context.Context, restConfig *rest.Config, object *appsv1.Deployment) error {
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	_, err = client.AppsV1().Deployments(object.Namespace).Create(ctx, object, metav1.CreateOptions{
+		DryRun:       []string{metav1.DryRunAll},
+		FieldManager: webhook.FieldManager,
+	})
+	if err == nil {
+		hclog.L().Info("Request was allowed", "namespace", object.Namespace)
+		hclog.L().Warn("The webhook may have been skipped: object not selected by policies or failurePolicy Ignore")
+		return nil
+	}
+	status, err := webhook.DryRunDenial(err)
+	if err != nil {
+		return err
+	}
+	hclog.L().Info("Request was denied by the webhook", "message", status.Message)
+	return nil
+}
+
+// SelfTestDirect posts AdmissionReview with the object to the handler and checks the response shape
+func SelfTestDirect(ctx context.Context, webhookConf config.WebHookConf, object *appsv1.Deployment) error {
+	handlerURL := selfTestURL
+	if handlerURL == "" {
+		if webhookURL := webhookConf.Webhook.ClientConfig.URL; webhookURL != nil {
+			handlerURL = *webhookURL
+		} else {
+			return fmt.Errorf("--url is required when the webhook uses service clientConfig")
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: selfTestInsecure}
+	if !selfTestInsecure {
+		restConfig, err := GenerateNewConfig(local)
+		if err != nil {
+			return err
+		}
+		api, err := webhook.AdmissionApiFromConfig(restConfig)
+		if err != nil {
+			return err
+		}
+		live, err := api.Get(ctx, webhookConf.Metadata.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to read caBundle of the live configuration, use --insecure to skip verification: %w", err)
+		}
+		roots := x509.NewCertPool()
+		for _, w := range live.Webhooks {
+			roots.AppendCertsFromPEM(w.ClientConfig.CABundle)
+		}
+		tlsConfig.RootCAs = roots
+		if webhookURL, err := url.Parse(handlerURL); err == nil && webhookConf.Webhook.ClientConfig.Service != nil {
+			// port-forwarded service is verified for the service name
+			service := webhookConf.Webhook.ClientConfig.Service
+			if webhookURL.Hostname() == "localhost" || webhookURL.Hostname() == "127.0.0.1" {
+				tlsConfig.ServerName = fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace)
+			}
+		}
+	}
+
+	review, err := webhook.SelfTestReview(object)
+	if err != nil {
+		return err
+	}
+	body, err := webhook.PostReview(ctx, handlerURL, tlsConfig, review)
+	if err != nil {
+		return err
+	}
+	response, err := webhook.CheckReviewResponse(review, body)
+	if err != nil {
+		return err
+	}
+
+	if response.Allowed {
+		hclog.L().Info("Request was allowed", "url", handlerURL, "warnings", response.Warnings)
+	} else {
+		hclog.L().Info("Request was denied", "url", handlerURL, "message", response.Result.Message)
+	}
+	return nil
+}
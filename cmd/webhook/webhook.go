@@ -15,6 +15,9 @@ func NewCmd() *cobra.Command {
 		NewWebhookGenCmd(),
 		NewWebHookCmd(),
 		NewWebhookRemCmd(),
+		NewAdmissionPolicyCmd(),
+		NewStatusCmd(),
+		NewSelfTestCmd(),
 	)
 	cmd.Flags().BoolVar(&fromFile, "from-file", false, "")
 	return cmd
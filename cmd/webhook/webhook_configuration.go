@@ -1,13 +1,16 @@
 package webhook
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 
 	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/config"
 	"github.com/alex123012/gitdeps/pkg/webhook"
 	"github.com/spf13/cobra"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -15,6 +18,7 @@ import (
 var (
 	kubeConfigPath string
 	local          bool
+	force          bool
 )
 
 func NewWebhookGenCmd() *cobra.Command {
@@ -24,27 +28,38 @@ func NewWebhookGenCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, _ []string) error {
 
 			ctx := cmd.Context()
-			config, err := GenerateNewConfig(local)
-			if err != nil {
-				return err
+			webhookConf := common.Config.WebhookConf
+			var config *rest.Config
+			var err error
+			if !dryRun || renderNeedsCluster(webhookConf) {
+				config, err = GenerateNewConfig(local)
+				if err != nil {
+					return err
+				}
 			}
 
-			caMap, err := webhook.GenerateCertificate(common.Config.WebhookConf, fromFile)
+			webhookConf, caBundle, caMap, err := PrepareWebhookConf(ctx, config, webhookConf, dryRun || diff)
 			if err != nil {
 				return err
 			}
 
-			err = webhook.CreateWebhookConf(ctx, config, caMap["ca"], common.Config.WebhookConf)
-			if err != nil {
-				return err
+			if diff || dryRun {
+				matchConditions, err := webhook.MatchConditionsEnabled(config, webhookConf)
+				if err != nil {
+					return err
+				}
+				if diff {
+					return DiffWebhookConf(ctx, config, webhookConf, caBundle, matchConditions)
+				}
+				return RenderWebhookConf(webhookConf, caBundle, caMap, matchConditions)
 			}
 
-			return nil
-
+			return ApplyWebhookConf(ctx, config, webhookConf, caBundle)
 		},
 	}
 
 	k8sCmdConfigFlags(cmd)
+	renderCmdFlags(cmd)
 	return cmd
 }
 
@@ -60,19 +75,57 @@ func NewWebhookRemCmd() *cobra.Command {
 				return err
 			}
 
-			api, err := webhook.AdmissionApiFromConfig(config)
-			if err != nil {
-				return err
-			}
-			err = api.Delete(ctx, common.Config.WebhookConf.Metadata.Name, metav1.DeleteOptions{})
-			return err
-
+			return RemoveWebhookConf(ctx, config, common.Config.WebhookConf, force)
 		},
 	}
 	k8sCmdConfigFlags(cmd)
+	cmd.Flags().BoolVar(&force, "force", false, "Delete webhook configurations that are not managed by this gitdeps instance")
 	return cmd
 }
 
+// ApplyWebhookConf applies validating and, if enabled, mutating webhook configurations
+func ApplyWebhookConf(ctx context.Context, config *rest.Config, webhookConf config.WebHookConf, caBundle *bytes.Buffer) error {
+	matchConditions, err := webhook.MatchConditionsEnabled(config, webhookConf)
+	if err != nil {
+		return err
+	}
+
+	err = webhook.CreateWebhookConf(ctx, config, caBundle, webhookConf, matchConditions)
+	if err != nil {
+		return err
+	}
+
+	if webhookConf.Mutating.Enabled {
+		return webhook.CreateMutatingWebhookConf(ctx, config, caBundle, webhookConf, matchConditions)
+	}
+	return nil
+}
+
+// RemoveWebhookConf removes validating and, if enabled, mutating webhook configurations
+func RemoveWebhookConf(ctx context.Context, config *rest.Config, webhookConf config.WebHookConf, force bool) error {
+	err := webhook.DeleteWebhookConf(ctx, config, webhookConf, force)
+	if err != nil {
+		return err
+	}
+
+	if webhookConf.Mutating.Enabled {
+		err = webhook.DeleteMutatingWebhookConf(ctx, config, webhookConf, force)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCertificate returns webhook certificates from the Secret if it is configured,
+// otherwise new certificates are generated
+func GetCertificate(ctx context.Context, config *rest.Config) (map[string]*bytes.Buffer, error) {
+	if webhook.CertificateSecretEnabled(common.Config.WebhookConf) {
+		return webhook.LoadOrCreateCertificate(ctx, config, common.Config.WebhookConf)
+	}
+	return webhook.GenerateCertificate(common.Config.WebhookConf, fromFile)
+}
+
 func k8sCmdConfigFlags(cmd *cobra.Command) {
 
 	cmd.Flags().BoolVar(&local, "local", false, "Use local kubeconfig")
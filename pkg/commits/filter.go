@@ -0,0 +1,146 @@
+package commits
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+// Commit is a commit checked by Filter
+type Commit struct {
+	AuthorName  string
+	AuthorEmail string
+	Message     string
+	// Files returns paths changed by the commit,
+	// it is called only if no other filter ignores the commit
+	Files func() ([]string, error)
+}
+
+// Filter selects default branch commits that are not required in the deploying branch
+type Filter struct {
+	paths    []string
+	authors  []string
+	messages []*regexp.Regexp
+	// scope are paths of the component, commits not changing them are ignored
+	scope []string
+}
+
+// NewFilter compiles the configured commit filters
+func NewFilter(conf config.IgnoreCommitsConf) (*Filter, error) {
+	filter := &Filter{
+		paths:   conf.Paths,
+		authors: conf.Authors,
+	}
+	for _, message := range conf.Messages {
+		re, err := regexp.Compile(message)
+		if err != nil {
+			return nil, fmt.Errorf("not valid commit message pattern %q: %w", message, err)
+		}
+		filter.messages = append(filter.messages, re)
+	}
+	return filter, nil
+}
+
+// WithScope returns the filter that also ignores commits which don't change
+// any of the scope paths, e.g. paths of a component in a monorepo
+func (f *Filter) WithScope(scope []string) *Filter {
+	scoped := &Filter{scope: scope}
+	if f != nil {
+		scoped.paths, scoped.authors, scoped.messages = f.paths, f.authors, f.messages
+	}
+	return scoped
+}
+
+// Empty reports whether the filter ignores nothing
+func (f *Filter) Empty() bool {
+	return f == nil || len(f.paths) == 0 && len(f.authors) == 0 && len(f.messages) == 0 && len(f.scope) == 0
+}
+
+// Ignored reports whether the commit is authored by an ignored author,
+// its message matches an ignored pattern or it changes ignored paths
+// and paths out of the scope only
+func (f *Filter) Ignored(commit Commit) (bool, error) {
+	if f.Empty() {
+		return false, nil
+	}
+	for _, author := range f.authors {
+		if author == commit.AuthorName || author == commit.AuthorEmail {
+			return true, nil
+		}
+	}
+	for _, re := range f.messages {
+		if re.MatchString(commit.Message) {
+			return true, nil
+		}
+	}
+
+	if !f.FiltersPaths() || commit.Files == nil {
+		return false, nil
+	}
+	files, err := commit.Files()
+	if err != nil {
+		return false, err
+	}
+	return f.IgnoredFiles(files), nil
+}
+
+// FiltersPaths reports whether commits are ignored by changed paths
+func (f *Filter) FiltersPaths() bool {
+	return f != nil && (len(f.paths) > 0 || len(f.scope) > 0)
+}
+
+// IgnoredFiles reports whether every file is ignored or out of the scope,
+// so commits changing only these files are ignored
+func (f *Filter) IgnoredFiles(files []string) bool {
+	if !f.FiltersPaths() {
+		return false
+	}
+	for _, file := range files {
+		if matchAny(f.paths, file) {
+			continue
+		}
+		if len(f.scope) == 0 || matchAny(f.scope, file) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if MatchPath(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether slash separated file path matches the glob pattern,
+// "**" matches any number of directories, other elements are matched by path.Match
+func MatchPath(pattern, file string) bool {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(file, "/"), "/"))
+}
+
+func matchSegments(pattern, file []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(file); i++ {
+				if matchSegments(pattern[1:], file[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(file) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], file[0]); err != nil || !ok {
+			return false
+		}
+		pattern, file = pattern[1:], file[1:]
+	}
+	return len(file) == 0
+}
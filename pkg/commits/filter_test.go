@@ -0,0 +1,116 @@
+package commits
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{pattern: "README.md", file: "README.md", want: true},
+		{pattern: "README.md", file: "docs/README.md", want: false},
+		{pattern: "*.md", file: "CHANGELOG.md", want: true},
+		{pattern: "*.md", file: "docs/index.md", want: false},
+		{pattern: "docs/**", file: "docs/index.md", want: true},
+		{pattern: "docs/**", file: "docs/api/v1/index.md", want: true},
+		{pattern: "docs/**", file: "docs", want: true},
+		{pattern: "docs/**", file: "src/docs/index.md", want: false},
+		{pattern: "**/*.md", file: "README.md", want: true},
+		{pattern: "**/*.md", file: "services/api/README.md", want: true},
+		{pattern: "**/*.md", file: "services/api/main.go", want: false},
+		{pattern: "services/*/Dockerfile", file: "services/api/Dockerfile", want: true},
+		{pattern: "services/*/Dockerfile", file: "services/api/build/Dockerfile", want: false},
+		{pattern: "services/**/test/**", file: "services/api/v2/test/fixtures/a.json", want: true},
+		{pattern: "/docs/", file: "docs", want: true},
+		{pattern: "[", file: "[", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.file, func(t *testing.T) {
+			if got := MatchPath(tt.pattern, tt.file); got != tt.want {
+				t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterIgnored(t *testing.T) {
+	filter, err := NewFilter(config.IgnoreCommitsConf{
+		Paths:    []string{"docs/**", "**/*.md"},
+		Authors:  []string{"renovate[bot]", "bot@example.com"},
+		Messages: []string{`^\[skip deploy\]`, `^Merge branch`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := func(files ...string) func() ([]string, error) {
+		return func() ([]string, error) { return files, nil }
+	}
+
+	tests := []struct {
+		name   string
+		scope  []string
+		commit Commit
+		want   bool
+	}{
+		{name: "author name", commit: Commit{AuthorName: "renovate[bot]", Files: files("go.mod")}, want: true},
+		{name: "author email", commit: Commit{AuthorEmail: "bot@example.com", Files: files("go.mod")}, want: true},
+		{name: "message", commit: Commit{Message: "[skip deploy] bump", Files: files("main.go")}, want: true},
+		{name: "ignored paths only", commit: Commit{Files: files("docs/index.md", "README.md")}, want: true},
+		{name: "ignored and required paths", commit: Commit{Files: files("docs/index.md", "main.go")}, want: false},
+		{name: "unknown files", commit: Commit{Message: "fix"}, want: false},
+		{name: "scope: out of scope", scope: []string{"services/api/**"}, commit: Commit{Files: files("services/web/main.go")}, want: true},
+		{name: "scope: in scope", scope: []string{"services/api/**"}, commit: Commit{Files: files("services/web/main.go", "services/api/main.go")}, want: false},
+		{name: "scope: ignored path in scope", scope: []string{"services/api/**"}, commit: Commit{Files: files("services/api/README.md")}, want: true},
+		{name: "scope: author", scope: []string{"services/api/**"}, commit: Commit{AuthorName: "renovate[bot]", Files: files("services/api/go.mod")}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filter.WithScope(tt.scope).Ignored(tt.commit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Ignored() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterIgnoredScopeOnly(t *testing.T) {
+	var filter *Filter
+	if !filter.Empty() {
+		t.Error("nil filter is expected to be empty")
+	}
+	scoped := filter.WithScope([]string{"services/api/**"})
+	if scoped.Empty() {
+		t.Error("scoped filter is not expected to be empty")
+	}
+	ignored, err := scoped.Ignored(Commit{Files: func() ([]string, error) { return []string{"services/web/main.go"}, nil }})
+	if err != nil || !ignored {
+		t.Errorf("Ignored() = %v, %v, want true", ignored, err)
+	}
+}
+
+func TestFilterIgnoredFilesError(t *testing.T) {
+	filter, err := NewFilter(config.IgnoreCommitsConf{Paths: []string{"docs/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("api error")
+	_, err = filter.Ignored(Commit{Files: func() ([]string, error) { return nil, failed }})
+	if !errors.Is(err, failed) {
+		t.Errorf("Ignored() error = %v, want %v", err, failed)
+	}
+}
+
+func TestNewFilterInvalidMessage(t *testing.T) {
+	if _, err := NewFilter(config.IgnoreCommitsConf{Messages: []string{"("}}); err == nil {
+		t.Error("expected error for invalid message pattern")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 	v1 "k8s.io/api/admissionregistration/v1"
@@ -18,6 +19,19 @@ type Config struct {
 	Hosts       Hosts       `yaml:"hosts" mapstructure:"hosts"`
 	WebhookConf WebHookConf `yaml:"webhook_conf" mapstructure:"webhook_conf"`
 	Git         GitConfig   `yaml:"git" mapstructure:"git"`
+	// IgnoreCommits are default branch commits that deploying branches may miss
+	IgnoreCommits IgnoreCommitsConf `yaml:"ignore_commits" mapstructure:"ignore_commits"`
+}
+
+// IgnoreCommitsConf selects commits by changed paths, authors and messages
+type IgnoreCommitsConf struct {
+	// Paths are globs, "**" matches any number of directories.
+	// Commits changing only matching paths are ignored
+	Paths []string `yaml:"paths" mapstructure:"paths"`
+	// Authors are names or emails of ignored commit authors, e.g. bots
+	Authors []string `yaml:"authors" mapstructure:"authors"`
+	// Messages are regular expressions of ignored commit messages, e.g. `\[gitdeps skip\]`
+	Messages []string `yaml:"messages" mapstructure:"messages"`
 }
 
 type GitConfig struct {
@@ -28,7 +42,133 @@ type GitConfig struct {
 type WebHookConf struct {
 	Metadata metav1.ObjectMeta    `yaml:"metadata" mapstructure:"metadata"`
 	Webhook  v1.ValidatingWebhook `yaml:"webhook" mapstructure:"webhook"`
-	Tls      CertificateConf      `yaml:"tls" mapstructure:"tls"`
+	// Webhooks are generated into one validating configuration,
+	// fields that are not set are taken from Webhook. Only Webhook is used if it is empty.
+	// Requests are checked by policies bound to any webhook served on the request path,
+	// so webhooks bound to different policies need different paths
+	Webhooks []v1.ValidatingWebhook `yaml:"webhooks" mapstructure:"webhooks"`
+	Mutating MutatingConf           `yaml:"mutating" mapstructure:"mutating"`
+	Tls      CertificateConf        `yaml:"tls" mapstructure:"tls"`
+
+	Policies []Policy `yaml:"policies" mapstructure:"policies"`
+	// ExcludedNamespaces are never sent to the webhooks,
+	// kube-system and the webhook service namespace are always excluded
+	ExcludedNamespaces []string `yaml:"excluded_namespaces" mapstructure:"excluded_namespaces"`
+	// MatchConditions enables CEL matchConditions generated from policies: auto, true or false.
+	// auto enables them if the cluster supports them
+	MatchConditions string `yaml:"match_conditions" mapstructure:"match_conditions"`
+
+	AdmissionPolicy AdmissionPolicyConf `yaml:"admission_policy" mapstructure:"admission_policy"`
+	Registration    RegistrationConf    `yaml:"registration" mapstructure:"registration"`
+	Skip            SkipConf            `yaml:"skip" mapstructure:"skip"`
+	Freeze          FreezeConf          `yaml:"freeze" mapstructure:"freeze"`
+}
+
+// FreezeConf configures deploy freeze windows
+type FreezeConf struct {
+	// GitLab enables deploy freeze periods of the deploying project and its parent groups
+	GitLab  bool               `yaml:"gitlab" mapstructure:"gitlab"`
+	Windows []FreezeWindowConf `yaml:"windows" mapstructure:"windows"`
+}
+
+// FreezeWindowConf is a freeze window from Start to End cron times in Timezone (UTC if empty)
+type FreezeWindowConf struct {
+	Name     string `yaml:"name" mapstructure:"name"`
+	Start    string `yaml:"start" mapstructure:"start"`
+	End      string `yaml:"end" mapstructure:"end"`
+	Timezone string `yaml:"timezone" mapstructure:"timezone"`
+}
+
+// SkipConf lists requesters whose requests are allowed without checks, e.g. controllers
+type SkipConf struct {
+	Users []string `yaml:"users" mapstructure:"users"`
+	// ServiceAccounts are "namespace/name", name may be "*" for every service account of the namespace
+	ServiceAccounts []string `yaml:"service_accounts" mapstructure:"service_accounts"`
+	Groups          []string `yaml:"groups" mapstructure:"groups"`
+}
+
+// RegistrationConf configures registration of the webhook configurations by start-handler.
+// Only the replica holding the Lease applies them. Every replica keeps its own member Lease,
+// the configurations are removed on shutdown of the replica that finds no other member Lease
+type RegistrationConf struct {
+	Enabled bool `yaml:"enabled" mapstructure:"enabled"`
+	// LeaseName defaults to the webhook configuration name,
+	// the Lease is created in the pod namespace or in the webhook service namespace
+	LeaseName     string        `yaml:"lease_name" mapstructure:"lease_name"`
+	LeaseDuration time.Duration `yaml:"lease_duration" mapstructure:"lease_duration"`
+	RenewDeadline time.Duration `yaml:"renew_deadline" mapstructure:"renew_deadline"`
+	RetryPeriod   time.Duration `yaml:"retry_period" mapstructure:"retry_period"`
+}
+
+// AdmissionPolicyConf configures ValidatingAdmissionPolicy that checks
+// presence of the pipeline url annotation without calling the webhook
+type AdmissionPolicyConf struct {
+	// Name of the policy and its binding, defaults to the webhook configuration name
+	Name string `yaml:"name" mapstructure:"name"`
+	// AllowedHosts of the pipeline url, defaults to hosts from config
+	AllowedHosts      []string `yaml:"allowed_hosts" mapstructure:"allowed_hosts"`
+	ValidationActions []string `yaml:"validation_actions" mapstructure:"validation_actions"`
+	FailurePolicy     string   `yaml:"failure_policy" mapstructure:"failure_policy"`
+}
+
+// Policy selects objects that are verified by the webhooks
+type Policy struct {
+	Name string `yaml:"name" mapstructure:"name"`
+	// Webhooks are names of the webhooks the policy is bound to, every webhook if empty
+	Webhooks []string `yaml:"webhooks" mapstructure:"webhooks"`
+	// Namespaces are enforced namespaces, every namespace if empty
+	Namespaces []string `yaml:"namespaces" mapstructure:"namespaces"`
+	// Selection is how objects are selected in the namespaces:
+	// all, label (gitdeps.io/enforce: "true") or annotation (pipeline url annotation)
+	Selection string `yaml:"selection" mapstructure:"selection"`
+	// Rollback is what to do with rollbacks and stale pipelines: deny (default) or warn
+	Rollback string `yaml:"rollback" mapstructure:"rollback"`
+	// RequireSuccess requires the deploying pipeline to have no failed or canceled jobs
+	RequireSuccess bool `yaml:"require_success" mapstructure:"require_success"`
+	// RequiredJobs are names of the pipeline jobs that must have succeeded
+	RequiredJobs []string `yaml:"required_jobs" mapstructure:"required_jobs"`
+	// RequireHealthyDefaultBranch requires the latest finished pipeline of the default branch to have succeeded
+	RequireHealthyDefaultBranch bool `yaml:"require_healthy_default_branch" mapstructure:"require_healthy_default_branch"`
+	// MaxPipelineAge denies pipelines older than that, disabled if zero
+	MaxPipelineAge time.Duration `yaml:"max_pipeline_age" mapstructure:"max_pipeline_age"`
+	// MaxBehindCommits allows the deploying branch to miss that many default branch commits
+	MaxBehindCommits int `yaml:"max_behind_commits" mapstructure:"max_behind_commits"`
+	// MaxMergeBaseAge denies branches whose merge-base with the default branch is older than that, disabled if zero
+	MaxMergeBaseAge time.Duration `yaml:"max_merge_base_age" mapstructure:"max_merge_base_age"`
+	Promotion       PromotionConf `yaml:"promotion" mapstructure:"promotion"`
+	// Components map object names to their paths in a monorepo, only default branch commits
+	// changing them are required
+	Components map[string][]string `yaml:"components" mapstructure:"components"`
+	// AllowPathsAnnotation allows gitdeps.io/paths annotation of the object to replace its component paths
+	AllowPathsAnnotation bool `yaml:"allow_paths_annotation" mapstructure:"allow_paths_annotation"`
+	// SharedPaths are added to paths of every component
+	SharedPaths []string `yaml:"shared_paths" mapstructure:"shared_paths"`
+	// CheckDependencies requires upstream versions from .gitdeps.yaml of the deploying commit to be running
+	CheckDependencies bool `yaml:"check_dependencies" mapstructure:"check_dependencies"`
+	// VerifySubmodules requires submodule commits of the deploying commit
+	// to be reachable from default branches of the submodule projects
+	VerifySubmodules bool `yaml:"verify_submodules" mapstructure:"verify_submodules"`
+	// FreezeExempt allows deploys during freeze windows
+	FreezeExempt bool `yaml:"freeze_exempt" mapstructure:"freeze_exempt"`
+	// AllowFreezeOverride allows deploys during freeze windows with gitdeps.io/freeze-override annotation
+	// set to the pipeline url or the commit sha of the deploy
+	AllowFreezeOverride bool `yaml:"allow_freeze_override" mapstructure:"allow_freeze_override"`
+}
+
+// PromotionConf requires the commit to be deployed to a previous environment first
+type PromotionConf struct {
+	// Source is where the previous deployment is looked up: gitlab (deployments to Environment)
+	// or cluster (workloads of the same project in Namespace), disabled if empty
+	Source      string `yaml:"source" mapstructure:"source"`
+	Environment string `yaml:"environment" mapstructure:"environment"`
+	Namespace   string `yaml:"namespace" mapstructure:"namespace"`
+	// Soak is minimal time since the commit was deployed there
+	Soak time.Duration `yaml:"soak" mapstructure:"soak"`
+}
+
+type MutatingConf struct {
+	Enabled bool               `yaml:"enabled" mapstructure:"enabled"`
+	Webhook v1.MutatingWebhook `yaml:"webhook" mapstructure:"webhook"`
 }
 
 type CertificateConf struct {
@@ -36,6 +176,42 @@ type CertificateConf struct {
 	CertFile     string `yaml:"cert_file" mapstructure:"cert_file"`
 	Organization string `yaml:"organization" mapstructure:"organization"`
 	Path         string `yaml:"path" mapstructure:"path"`
+
+	KeyType     string        `yaml:"key_type" mapstructure:"key_type"`
+	KeySize     int           `yaml:"key_size" mapstructure:"key_size"`
+	Validity    time.Duration `yaml:"validity" mapstructure:"validity"`
+	DNSNames    []string      `yaml:"dns_names" mapstructure:"dns_names"`
+	IPAddresses []string      `yaml:"ip_addresses" mapstructure:"ip_addresses"`
+
+	Secret      SecretConf      `yaml:"secret" mapstructure:"secret"`
+	Rotation    RotationConf    `yaml:"rotation" mapstructure:"rotation"`
+	CertManager CertManagerConf `yaml:"cert_manager" mapstructure:"cert_manager"`
+}
+
+// CertManagerConf configures webhook TLS issued by cert-manager.
+// The serving certificate is read from the mounted Secret files at tls.path,
+// caBundle is taken from CASecret if it is set, otherwise it is injected
+// by cert-manager from Certificate ("namespace/name")
+type CertManagerConf struct {
+	Enabled     bool       `yaml:"enabled" mapstructure:"enabled"`
+	Certificate string     `yaml:"certificate" mapstructure:"certificate"`
+	CASecret    SecretConf `yaml:"ca_secret" mapstructure:"ca_secret"`
+}
+
+// RotationConf configures renewal of the generated certificates
+// by the running webhook server, certificates must be kept in tls.secret
+type RotationConf struct {
+	Enabled       bool          `yaml:"enabled" mapstructure:"enabled"`
+	CheckInterval time.Duration `yaml:"check_interval" mapstructure:"check_interval"`
+	RenewBefore   time.Duration `yaml:"renew_before" mapstructure:"renew_before"`
+	CARenewBefore time.Duration `yaml:"ca_renew_before" mapstructure:"ca_renew_before"`
+}
+
+// SecretConf points to the Secret where certificates are stored,
+// namespace defaults to the webhook service namespace
+type SecretConf struct {
+	Name      string `yaml:"name" mapstructure:"name"`
+	Namespace string `yaml:"namespace" mapstructure:"namespace"`
 }
 type Hosts map[string]Host
 
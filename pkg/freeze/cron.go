@@ -0,0 +1,37 @@
+package freeze
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// Schedule is a standard five field cron expression:
+// minute, hour, day of month, month and day of week
+type Schedule struct {
+	spec cron.Schedule
+}
+
+// parser accepts the fields of GitLab freeze periods: values, ranges, steps,
+// lists, month and day of week names, "?" and descriptors such as @weekly
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ParseSchedule parses five field cron expression
+func ParseSchedule(spec string) (*Schedule, error) {
+	schedule, err := parser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("not valid cron expression %q: %w", spec, err)
+	}
+	if _, ok := schedule.(*cron.SpecSchedule); !ok {
+		return nil, fmt.Errorf("not valid cron expression %q: intervals are not supported", spec)
+	}
+	return &Schedule{spec: schedule}, nil
+}
+
+// Next returns the first schedule time after t in the location of t,
+// false is returned if there is none in 5 years
+func (s *Schedule) Next(t time.Time) (time.Time, bool) {
+	next := s.spec.Next(t)
+	return next, !next.IsZero()
+}
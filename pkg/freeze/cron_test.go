@@ -0,0 +1,75 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone %s is not available: %v", name, err)
+	}
+	return location
+}
+
+func TestScheduleNext(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{name: "month end", spec: "0 0 1 * *", from: time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC), want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "skips short month", spec: "0 12 31 * *", from: time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC)},
+		{name: "leap day", spec: "0 0 29 2 *", from: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "year end", spec: "0 0 * * *", from: time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC), want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "step", spec: "*/15 * * * *", from: time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC), want: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{name: "strictly after", spec: "0 10 * * *", from: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), want: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{name: "day of month or week", spec: "0 0 1 * 1", from: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC)},
+		{name: "day step is a star", spec: "0 0 */2 * 1", from: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)},
+		{name: "names", spec: "0 0 * FEB MON", from: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)},
+		{name: "name range", spec: "0 18 * * mon-fri", from: time.Date(2024, 4, 5, 19, 0, 0, 0, time.UTC), want: time.Date(2024, 4, 8, 18, 0, 0, 0, time.UTC)},
+		{name: "question mark", spec: "0 0 1 * ?", from: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "descriptor", spec: "@weekly", from: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), want: time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC)},
+		{name: "after spring forward", spec: "0 3 * * *", from: time.Date(2024, 3, 31, 0, 0, 0, 0, berlin), want: time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC)},
+		{name: "nonexistent time is skipped", spec: "30 2 * * *", from: time.Date(2024, 3, 30, 12, 0, 0, 0, berlin), want: time.Date(2024, 4, 1, 0, 30, 0, 0, time.UTC)},
+		{name: "after fall back", spec: "0 4 * * *", from: time.Date(2024, 10, 27, 0, 0, 0, 0, berlin), want: time.Date(2024, 10, 27, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := schedule.Next(tt.from)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, %v, want %s", tt.from, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"0 0 L * *",
+		"@every 1h",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParseSchedule(spec); err == nil {
+				t.Errorf("ParseSchedule(%q) expected error", spec)
+			}
+		})
+	}
+}
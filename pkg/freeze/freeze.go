@@ -0,0 +1,92 @@
+package freeze
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+// Window is a recurring freeze period, that starts at Start schedule times
+// and ends at the following End schedule times
+type Window struct {
+	Name       string
+	Start, End *Schedule
+	Location   *time.Location
+}
+
+// NewWindow parses start and end cron expressions, empty timezone is UTC
+func NewWindow(name, start, end, timezone string) (*Window, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("freeze window %s: %w", name, err)
+	}
+	startSchedule, err := ParseSchedule(start)
+	if err != nil {
+		return nil, fmt.Errorf("freeze window %s start: %w", name, err)
+	}
+	endSchedule, err := ParseSchedule(end)
+	if err != nil {
+		return nil, fmt.Errorf("freeze window %s end: %w", name, err)
+	}
+	return &Window{Name: name, Start: startSchedule, End: endSchedule, Location: location}, nil
+}
+
+// lookbacks are how far before t the start of the window in effect is searched.
+// The shortest one with an end time in it is used, as windows started earlier have ended
+var lookbacks = []time.Duration{24 * time.Hour, 32 * 24 * time.Hour, 367 * 24 * time.Hour}
+
+// Active reports whether the freeze is in effect at t and when it ends
+func (w *Window) Active(t time.Time) (bool, time.Time) {
+	t = t.In(w.Location)
+	from := t.Add(-lookbacks[len(lookbacks)-1])
+	for _, lookback := range lookbacks {
+		if end, ok := w.End.Next(t.Add(-lookback)); ok && !end.After(t) {
+			from = t.Add(-lookback)
+			break
+		}
+	}
+
+	// every window runs from a start time to the following end time,
+	// starts before the end of the window don't begin a new one
+	start, ok := w.Start.Next(from.Add(-time.Second))
+	for ok && !start.After(t) {
+		if end, _ := w.End.Next(start.Add(-time.Second)); end.Equal(start) {
+			// the window ends as soon as it starts
+			start, ok = w.Start.Next(start)
+			continue
+		}
+		end, found := w.End.Next(start)
+		if !found || end.After(t) {
+			return true, end
+		}
+		start, ok = w.Start.Next(end)
+	}
+	return false, time.Time{}
+}
+
+// Active returns the window that is in effect at t and ends the latest
+func Active(windows []*Window, t time.Time) (*Window, time.Time, bool) {
+	var active *Window
+	var activeEnd time.Time
+	for _, window := range windows {
+		ok, end := window.Active(t)
+		if ok && (active == nil || end.After(activeEnd)) {
+			active, activeEnd = window, end
+		}
+	}
+	return active, activeEnd, active != nil
+}
+
+// ConfiguredWindows returns freeze windows from the configuration
+func ConfiguredWindows(freezeConf config.FreezeConf) ([]*Window, error) {
+	windows := make([]*Window, 0, len(freezeConf.Windows))
+	for _, windowConf := range freezeConf.Windows {
+		window, err := NewWindow(windowConf.Name, windowConf.Start, windowConf.End, windowConf.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
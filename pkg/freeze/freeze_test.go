@@ -0,0 +1,112 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowActive(t *testing.T) {
+	weekend, err := NewWindow("weekend", "0 23 * * 5", "0 7 * * 1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monday := time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		at      time.Time
+		active  bool
+		wantEnd time.Time
+	}{
+		{name: "before start", at: time.Date(2024, 3, 1, 22, 59, 0, 0, time.UTC)},
+		{name: "at start", at: time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC), active: true, wantEnd: monday},
+		{name: "saturday", at: time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), active: true, wantEnd: monday},
+		{name: "before end", at: time.Date(2024, 3, 4, 6, 59, 0, 0, time.UTC), active: true, wantEnd: monday},
+		{name: "at end", at: monday},
+		{name: "midweek", at: time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)},
+		{name: "across month end", at: time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC), active: true, wantEnd: time.Date(2024, 4, 1, 7, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, end := weekend.Active(tt.at)
+			if active != tt.active || !end.Equal(tt.wantEnd) {
+				t.Errorf("Active(%s) = %v, %s, want %v, %s", tt.at, active, end, tt.active, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestWindowActiveTimezone(t *testing.T) {
+	weekend, err := NewWindow("weekend", "0 23 * * 5", "0 7 * * 1", "Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone is not available: %v", err)
+	}
+	tests := []struct {
+		name    string
+		at      time.Time
+		active  bool
+		wantEnd time.Time
+	}{
+		// clocks move forward on 2024-03-31, the window starts in CET and ends in CEST
+		{name: "friday in utc", at: time.Date(2024, 3, 29, 22, 30, 0, 0, time.UTC), active: true, wantEnd: time.Date(2024, 4, 1, 5, 0, 0, 0, time.UTC)},
+		{name: "sunday", at: time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC), active: true, wantEnd: time.Date(2024, 4, 1, 5, 0, 0, 0, time.UTC)},
+		{name: "monday after end", at: time.Date(2024, 4, 1, 5, 0, 0, 0, time.UTC)},
+		{name: "friday before start", at: time.Date(2024, 3, 29, 21, 59, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, end := weekend.Active(tt.at)
+			if active != tt.active || !end.Equal(tt.wantEnd) {
+				t.Errorf("Active(%s) = %v, %s, want %v, %s", tt.at, active, end, tt.active, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestActive(t *testing.T) {
+	nights, err := NewWindow("nights", "0 20 * * *", "0 8 * * *", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekend, err := NewWindow("weekend", "0 23 * * 5", "0 7 * * 1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	windows := []*Window{nights, weekend}
+
+	window, end, ok := Active(windows, time.Date(2024, 3, 2, 21, 0, 0, 0, time.UTC))
+	if !ok || window != weekend || !end.Equal(time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("Active() = %v, %s, %v, want weekend window ending on monday", window, end, ok)
+	}
+	if _, _, ok := Active(windows, time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)); ok {
+		t.Error("Active() at wednesday noon expected no window")
+	}
+}
+
+func TestWindowActiveSchedules(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		at         time.Time
+		active     bool
+		wantEnd    time.Time
+	}{
+		{name: "yearly started last year", start: "0 0 20 12 *", end: "0 0 6 1 *", at: time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC), active: true, wantEnd: time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{name: "yearly after end", start: "0 0 20 12 *", end: "0 0 6 1 *", at: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "monthly started weeks ago", start: "0 0 1 * *", end: "0 0 25 * *", at: time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC), active: true, wantEnd: time.Date(2024, 5, 25, 0, 0, 0, 0, time.UTC)},
+		{name: "starts inside window are ignored", start: "0 * * * *", end: "0 12 * * *", at: time.Date(2024, 5, 20, 11, 30, 0, 0, time.UTC), active: true, wantEnd: time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)},
+		{name: "start and end at the same time", start: "0 12 * * *", end: "0 12 * * *", at: time.Date(2024, 5, 20, 13, 0, 0, 0, time.UTC)},
+		{name: "hourly window", start: "0 * * * *", end: "15 * * * *", at: time.Date(2024, 5, 20, 13, 10, 0, 0, time.UTC), active: true, wantEnd: time.Date(2024, 5, 20, 13, 15, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, err := NewWindow(tt.name, tt.start, tt.end, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			active, end := window.Active(tt.at)
+			if active != tt.active || !end.Equal(tt.wantEnd) {
+				t.Errorf("Active(%s) = %v, %s, want %v, %s", tt.at, active, end, tt.active, tt.wantEnd)
+			}
+		})
+	}
+}
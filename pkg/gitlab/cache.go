@@ -0,0 +1,82 @@
+package gitlab
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/client"
+)
+
+// VerificationTTL is how long VerifyPipelineCached reuses a verification,
+// it covers the mutating and validating admission of the same request
+const VerificationTTL = 30 * time.Second
+
+type cachedVerification struct {
+	verification Verification
+	expires      time.Time
+}
+
+var verifications = struct {
+	mu    sync.Mutex
+	items map[string]cachedVerification
+}{items: map[string]cachedVerification{}}
+
+// VerifyPipelineCached is VerifyPipeline that reuses the result for the same
+// pipeline and options for VerificationTTL. Errors are not cached.
+func VerifyPipelineCached(annotationValue string, opts VerifyOptions) (*Verification, error) {
+	key := fmt.Sprintf("%s\x00%+v", annotationValue, opts)
+	now := time.Now()
+
+	verifications.mu.Lock()
+	for k, item := range verifications.items {
+		if !now.Before(item.expires) {
+			delete(verifications.items, k)
+		}
+	}
+	item, ok := verifications.items[key]
+	verifications.mu.Unlock()
+	if ok {
+		verification := item.verification
+		return &verification, nil
+	}
+
+	verification, err := VerifyPipeline(annotationValue, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	verifications.mu.Lock()
+	verifications.items[key] = cachedVerification{verification: *verification, expires: now.Add(VerificationTTL)}
+	verifications.mu.Unlock()
+	return verification, nil
+}
+
+// maxCachedCommits bounds the commit files cache, it is emptied when full
+const maxCachedCommits = 10000
+
+// commitFiles caches files changed by commits, they never change
+var commitFiles = struct {
+	mu    sync.Mutex
+	items map[string][]string
+}{items: map[string][]string{}}
+
+func commitFilesKey(host *client.Host, projectPath, sha string) string {
+	return fmt.Sprintf("%s\x00%s\x00%s", host.URL, projectPath, sha)
+}
+
+func cachedCommitFiles(host *client.Host, projectPath, sha string) ([]string, bool) {
+	commitFiles.mu.Lock()
+	defer commitFiles.mu.Unlock()
+	files, ok := commitFiles.items[commitFilesKey(host, projectPath, sha)]
+	return files, ok
+}
+
+func cacheCommitFiles(host *client.Host, projectPath, sha string, files []string) {
+	commitFiles.mu.Lock()
+	defer commitFiles.mu.Unlock()
+	if len(commitFiles.items) >= maxCachedCommits {
+		commitFiles.items = map[string][]string{}
+	}
+	commitFiles.items[commitFilesKey(host, projectPath, sha)] = files
+}
@@ -0,0 +1,86 @@
+package gitlab
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/alex123012/gitdeps/pkg/client"
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+)
+
+// DependencyManifestFile is the dependency manifest path in the project repository
+const DependencyManifestFile = ".gitdeps.yaml"
+
+// DependencyManifest is .gitdeps.yaml of a project, it lists upstream projects
+// and their minimal versions the project requires
+type DependencyManifest struct {
+	Dependencies []Dependency `yaml:"dependencies"`
+}
+
+// Dependency is an upstream project version that must be running
+// before the project is deployed
+type Dependency struct {
+	// Project is path of the upstream project on the same GitLab host
+	Project string `yaml:"project"`
+	// Ref is commit or tag the running upstream version must contain
+	Ref string `yaml:"ref"`
+	// Namespace where the upstream runs, namespace of the deploying object if empty
+	Namespace string `yaml:"namespace"`
+}
+
+// GetDependencyManifest returns the dependency manifest of the project at sha,
+// nil is returned if the project has no manifest
+func GetDependencyManifest(host *client.Host, projectPath, sha string) (*DependencyManifest, error) {
+	data, found, err := GetRawFile(host, projectPath, DependencyManifestFile, sha)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	manifest := &DependencyManifest{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("not valid %s of %s: %w", DependencyManifestFile, projectPath, err)
+	}
+	return manifest, nil
+}
+
+// GetRawFile returns the file content at ref, false is returned if there is no such file
+func GetRawFile(host *client.Host, projectPath, file, ref string) ([]byte, bool, error) {
+	data, _, err := host.Client.RepositoryFiles.GetRawFile(projectPath, file, &gitlab.GetRawFileOptions{Ref: &ref})
+	if isNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// isNotFound reports whether the GitLab api responded with 404
+func isNotFound(err error) bool {
+	var errorResponse *gitlab.ErrorResponse
+	return errors.As(err, &errorResponse) && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusNotFound
+}
+
+// ResolveCommit returns commit sha of the ref, e.g. tag
+func ResolveCommit(host *client.Host, projectPath, ref string) (string, error) {
+	commit, _, err := host.Client.Commits.GetCommit(projectPath, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s of %s: %w", ref, projectPath, err)
+	}
+	return commit.ID, nil
+}
+
+// ContainsCommit reports whether ancestor is sha or its ancestor
+func ContainsCommit(host *client.Host, projectPath, sha, ancestor string) (bool, error) {
+	if sha == ancestor {
+		return true, nil
+	}
+	refs := []string{sha, ancestor}
+	mergeBase, _, err := host.Client.Repositories.MergeBase(projectPath, &gitlab.MergeBaseOptions{Ref: &refs})
+	if err != nil {
+		return false, err
+	}
+	return mergeBase.ID == ancestor, nil
+}
@@ -0,0 +1,30 @@
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDependencyManifestDecode(t *testing.T) {
+	data := []byte(`
+dependencies:
+  - project: group/upstream
+    ref: v1.2.0
+  - project: group/db
+    ref: 0a1b2c3
+    namespace: databases
+`)
+	manifest := &DependencyManifest{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := []Dependency{
+		{Project: "group/upstream", Ref: "v1.2.0"},
+		{Project: "group/db", Ref: "0a1b2c3", Namespace: "databases"},
+	}
+	if !reflect.DeepEqual(manifest.Dependencies, want) {
+		t.Errorf("dependencies = %+v, want %+v", manifest.Dependencies, want)
+	}
+}
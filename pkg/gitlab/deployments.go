@@ -0,0 +1,61 @@
+package gitlab
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// maxDeploymentPages bounds the deployments CheckPromotion looks through
+const maxDeploymentPages = 10
+
+// CheckPromotion returns why the commit sha of the project from annotationValue
+// is not promoted from the environment, empty string is returned if it has
+// a successful deployment there that is at least soak old.
+// Deployments are listed from the newest until the commit date, at most maxDeploymentPages pages.
+func CheckPromotion(annotationValue, environment, sha string, soak time.Duration, now time.Time) (string, error) {
+	host, projectPath, _, err := ParsePipelineURL(annotationValue)
+	if err != nil {
+		return "", err
+	}
+	commit, _, err := host.Client.Commits.GetCommit(projectPath, sha)
+	if err != nil {
+		return "", err
+	}
+
+	status, orderBy, sort := "success", "updated_at", "desc"
+	opts := &gitlab.ListProjectDeploymentsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+		Environment: &environment,
+		Status:      &status,
+		OrderBy:     &orderBy,
+		Sort:        &sort,
+	}
+	notDeployed := fmt.Sprintf("commit %s was not deployed to %s", sha, environment)
+	for page := 0; page < maxDeploymentPages; page++ {
+		deployments, resp, err := host.Client.Deployments.ListProjectDeployments(projectPath, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, deployment := range deployments {
+			if deployment.UpdatedAt != nil && commit.CommittedDate != nil && deployment.UpdatedAt.Before(*commit.CommittedDate) {
+				// older deployments can't have the commit
+				return notDeployed, nil
+			}
+			if deployment.SHA != sha {
+				continue
+			}
+			if deployment.UpdatedAt != nil && now.Sub(*deployment.UpdatedAt) < soak {
+				return fmt.Sprintf("commit %s was deployed to %s %s ago, minimal soak time is %s",
+					sha, environment, now.Sub(*deployment.UpdatedAt).Round(time.Second), soak), nil
+			}
+			return "", nil
+		}
+		if resp.NextPage == 0 {
+			return notDeployed, nil
+		}
+		opts.Page = resp.NextPage
+	}
+	return fmt.Sprintf("commit %s is not found in the latest %d deployments to %s", sha, maxDeploymentPages*100, environment), nil
+}
@@ -0,0 +1,102 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/alex123012/gitdeps/pkg/client"
+	"github.com/alex123012/gitdeps/pkg/freeze"
+	"github.com/xanzy/go-gitlab"
+)
+
+// GetFreezeWindows returns deploy freeze periods of the project from annotationValue
+// and of its parent groups
+func GetFreezeWindows(annotationValue string) ([]*freeze.Window, error) {
+	host, projectPath, _, err := ParsePipelineURL(annotationValue)
+	if err != nil {
+		return nil, err
+	}
+
+	periods, err := listFreezePeriods(func(opts *gitlab.ListFreezePeriodsOptions) ([]*gitlab.FreezePeriod, *gitlab.Response, error) {
+		return host.Client.FreezePeriods.ListFreezePeriods(projectPath, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	windows, err := freezeWindows(periods, projectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range ParentGroups(projectPath) {
+		periods, err := listFreezePeriods(func(opts *gitlab.ListFreezePeriodsOptions) ([]*gitlab.FreezePeriod, *gitlab.Response, error) {
+			return listGroupFreezePeriods(host, group, opts)
+		})
+		if isNotFound(err) {
+			// user namespace or GitLab without group freeze periods
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		groupWindows, err := freezeWindows(periods, group)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, groupWindows...)
+	}
+	return windows, nil
+}
+
+// ParentGroups returns full paths of the groups the project is nested in, closest first
+func ParentGroups(projectPath string) []string {
+	var groups []string
+	for group := path.Dir(projectPath); group != "." && group != "/"; group = path.Dir(group) {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func listFreezePeriods(list func(opts *gitlab.ListFreezePeriodsOptions) ([]*gitlab.FreezePeriod, *gitlab.Response, error)) ([]*gitlab.FreezePeriod, error) {
+	opts := &gitlab.ListFreezePeriodsOptions{PerPage: 100}
+	var periods []*gitlab.FreezePeriod
+	for {
+		page, resp, err := list(opts)
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, page...)
+		if resp.NextPage == 0 {
+			return periods, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listGroupFreezePeriods lists freeze periods of the group, go-gitlab has only the project ones
+func listGroupFreezePeriods(host *client.Host, group string, opts *gitlab.ListFreezePeriodsOptions) ([]*gitlab.FreezePeriod, *gitlab.Response, error) {
+	req, err := host.Client.NewRequest(http.MethodGet, fmt.Sprintf("groups/%s/freeze_periods", gitlab.PathEscape(group)), opts, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var periods []*gitlab.FreezePeriod
+	resp, err := host.Client.Do(req, &periods)
+	if err != nil {
+		return nil, resp, err
+	}
+	return periods, resp, nil
+}
+
+func freezeWindows(periods []*gitlab.FreezePeriod, owner string) ([]*freeze.Window, error) {
+	windows := make([]*freeze.Window, 0, len(periods))
+	for _, period := range periods {
+		window, err := freeze.NewWindow(fmt.Sprintf("freeze period %d of %s", period.ID, owner),
+			period.FreezeStart, period.FreezeEnd, period.CronTimezone)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
@@ -0,0 +1,73 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/client"
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+func TestParentGroups(t *testing.T) {
+	tests := []struct {
+		projectPath string
+		want        []string
+	}{
+		{projectPath: "group/app", want: []string{"group"}},
+		{projectPath: "top/sub/app", want: []string{"top/sub", "top"}},
+		{projectPath: "app", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.projectPath, func(t *testing.T) {
+			if got := ParentGroups(tt.projectPath); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParentGroups(%q) = %v, want %v", tt.projectPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFreezeWindows(t *testing.T) {
+	period := func(id int) string {
+		return fmt.Sprintf(`[{"id": %d, "freeze_start": "0 23 * * FRI", "freeze_end": "0 7 * * MON", "cron_timezone": "UTC"}]`, id)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/top%2Fsub%2Fapp/freeze_periods":
+			fmt.Fprint(w, period(1))
+		case "/api/v4/groups/top%2Fsub/freeze_periods":
+			fmt.Fprint(w, period(2))
+		default:
+			http.Error(w, `{"message": "404 Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	gitlabClient, err := client.NewClient(&config.Config{Hosts: map[string]config.Host{
+		"main": {URL: server.URL, Token: "token"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := common.Client
+	common.Client = gitlabClient
+	defer func() { common.Client = previous }()
+
+	windows, err := GetFreezeWindows(server.URL + "/top/sub/app/pipelines/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, window := range windows {
+		names = append(names, window.Name)
+	}
+	sort.Strings(names)
+	want := []string{"freeze period 1 of top/sub/app", "freeze period 2 of top/sub"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("windows = %v, want %v", names, want)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alex123012/gitdeps/cmd/common"
 	"github.com/alex123012/gitdeps/pkg/client"
+	"github.com/alex123012/gitdeps/pkg/commits"
+	"github.com/alex123012/gitdeps/pkg/config"
 	"github.com/xanzy/go-gitlab"
 )
 
@@ -19,8 +22,48 @@ func GetHostByAnnotation(gl *client.Client, hostUrl string) (*client.Host, error
 	return host, nil
 }
 
-func GetBranchByPipeline(host *client.Host, projectPath string, pipelineNumber int) (string, error) {
+// Verification holds the refs and commits that were compared for a pipeline
+type Verification struct {
+	Allowed     bool
+	ProjectPath string
+	TargetRef   string
+	TargetSHA   string
+	BaseRef     string
+	BaseSHA     string
+	// BehindCommits is the number of default branch commits missing from the target branch
+	BehindCommits int
+	// Reason is why the pipeline is not allowed by VerifyOptions checks
+	Reason string
+}
+
+// VerifyOptions are additional checks of VerifyPipeline
+type VerifyOptions struct {
+	// RequireHealthyBase requires the latest finished pipeline of the default branch to have succeeded
+	RequireHealthyBase bool
+	// MaxPipelineAge denies pipelines created earlier, disabled if zero
+	MaxPipelineAge time.Duration
+	// MaxBehindCommits allows the target branch to miss that many default branch commits
+	MaxBehindCommits int
+	// MaxMergeBaseAge denies branches whose merge-base with the default branch
+	// was committed earlier, disabled if zero
+	MaxMergeBaseAge time.Duration
+	// IgnoreCommits are default branch commits the target branch may miss
+	IgnoreCommits config.IgnoreCommitsConf
+	// Paths scope required commits to the ones changing these paths, every commit is required if empty
+	Paths []string
+}
+
+func GetPipeline(host *client.Host, projectPath string, pipelineNumber int) (*gitlab.Pipeline, error) {
 	pipeline, _, err := host.Client.Pipelines.GetPipeline(projectPath, pipelineNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return pipeline, nil
+}
+
+func GetBranchByPipeline(host *client.Host, projectPath string, pipelineNumber int) (string, error) {
+	pipeline, err := GetPipeline(host, projectPath, pipelineNumber)
 	if err != nil {
 		return "", err
 	}
@@ -28,6 +71,38 @@ func GetBranchByPipeline(host *client.Host, projectPath string, pipelineNumber i
 	return pipeline.Ref, nil
 }
 
+// GetLatestFinishedPipeline returns the latest finished pipeline of the branch,
+// nil is returned if there are none
+func GetLatestFinishedPipeline(host *client.Host, projectPath, branchName string) (*gitlab.PipelineInfo, error) {
+	scope, orderBy, sort := "finished", "id", "desc"
+	pipelines, _, err := host.Client.Pipelines.ListProjectPipelines(projectPath, &gitlab.ListProjectPipelinesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1},
+		Scope:       &scope,
+		Ref:         &branchName,
+		OrderBy:     &orderBy,
+		Sort:        &sort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pipelines) == 0 {
+		return nil, nil
+	}
+	return pipelines[0], nil
+}
+
+func GetBranchHead(host *client.Host, projectPath, branchName string) (string, error) {
+	branch, _, err := host.Client.Branches.GetBranch(projectPath, branchName)
+	if err != nil {
+		return "", err
+	}
+	if branch.Commit == nil {
+		return "", fmt.Errorf("branch %q of %q has no commit", branchName, projectPath)
+	}
+
+	return branch.Commit.ID, nil
+}
+
 func GetDefaultBranch(host *client.Host, projectPath string) (string, error) {
 	project, _, err := host.Client.Projects.GetProject(projectPath, &gitlab.GetProjectOptions{})
 	if err != nil {
@@ -50,42 +125,293 @@ func CompareBranches(host *client.Host, projectPath, defaultBranch, targetBranch
 	}
 	return compare, nil
 }
-func TargetHaveAllCommitsFromDefault(annotationValue string) (bool, error) {
+
+// ParsePipelineURL returns configured host, project path and pipeline number
+// of the pipeline url from annotation
+func ParsePipelineURL(annotationValue string) (*client.Host, string, int, error) {
 	splitUrl := strings.Split(client.TrimUrl(annotationValue), "/")
 
 	hostUrl := splitUrl[0]
 	host, err := GetHostByAnnotation(common.Client, hostUrl)
 	if err != nil {
-		return false, err
+		return nil, "", 0, err
 	}
 
 	pipelineNumber, err := strconv.Atoi(splitUrl[len(splitUrl)-1])
 	if err != nil {
-		return false, err
+		return nil, "", 0, err
+	}
+	if len(splitUrl) < 4 {
+		return nil, "", 0, fmt.Errorf("no project found in pipeline url %q", annotationValue)
 	}
 	projectPath := strings.Join(splitUrl[1:len(splitUrl)-2], "/")
-	targetBranch, err := GetBranchByPipeline(host, projectPath, pipelineNumber)
+	return host, projectPath, pipelineNumber, nil
+}
+
+func TargetHaveAllCommitsFromDefault(annotationValue string) (bool, error) {
+	verification, err := VerifyPipeline(annotationValue, VerifyOptions{IgnoreCommits: common.Config.IgnoreCommits})
 	if err != nil {
 		return false, err
 	}
+	return verification.Allowed, nil
+}
+
+// VerifyPipeline checks that the branch of the pipeline from annotationValue
+// contains all commits from the project default branch
+func VerifyPipeline(annotationValue string, opts VerifyOptions) (*Verification, error) {
+	host, projectPath, pipelineNumber, err := ParsePipelineURL(annotationValue)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := GetPipeline(host, projectPath, pipelineNumber)
+	if err != nil {
+		return nil, err
+	}
+	targetBranch := pipeline.Ref
 
 	defaultBranch, err := GetDefaultBranch(host, projectPath)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	defaultSHA, err := GetBranchHead(host, projectPath, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &Verification{
+		ProjectPath: projectPath,
+		TargetRef:   targetBranch,
+		TargetSHA:   pipeline.SHA,
+		BaseRef:     defaultBranch,
+		BaseSHA:     defaultSHA,
+	}
+
+	if opts.RequireHealthyBase {
+		basePipeline, err := GetLatestFinishedPipeline(host, projectPath, defaultBranch)
+		if err != nil {
+			return nil, err
+		}
+		if basePipeline == nil {
+			verification.Reason = fmt.Sprintf("default branch %s has no finished pipelines", defaultBranch)
+			return verification, nil
+		}
+		if basePipeline.Status != "success" {
+			verification.Reason = fmt.Sprintf("latest pipeline of default branch %s is %s: %s", defaultBranch, basePipeline.Status, basePipeline.WebURL)
+			return verification, nil
+		}
+	}
+
+	if opts.MaxPipelineAge > 0 && pipeline.CreatedAt != nil {
+		if age := time.Since(*pipeline.CreatedAt); age > opts.MaxPipelineAge {
+			verification.Reason = fmt.Sprintf("pipeline %d was created %s ago, maximal age is %s",
+				pipeline.ID, age.Round(time.Second), opts.MaxPipelineAge)
+			return verification, nil
+		}
 	}
 
 	if defaultBranch == targetBranch {
-		return true, nil
+		verification.Allowed = true
+		return verification, nil
+	}
+
+	if opts.MaxMergeBaseAge > 0 {
+		refs := []string{pipeline.SHA, defaultSHA}
+		mergeBase, _, err := host.Client.Repositories.MergeBase(projectPath, &gitlab.MergeBaseOptions{Ref: &refs})
+		if err != nil {
+			return nil, err
+		}
+		if mergeBase.CommittedDate != nil {
+			if age := time.Since(*mergeBase.CommittedDate); age > opts.MaxMergeBaseAge {
+				verification.Reason = fmt.Sprintf("merge-base %s of %s and %s was committed %s ago, maximal age is %s",
+					mergeBase.ShortID, targetBranch, defaultBranch, age.Round(time.Second), opts.MaxMergeBaseAge)
+				return verification, nil
+			}
+		}
 	}
 
 	compare, err := CompareBranches(host, projectPath, defaultBranch, targetBranch)
 
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	filter, err := commits.NewFilter(opts.IgnoreCommits)
+	if err != nil {
+		return nil, err
+	}
+	required, err := RequiredCommits(host, projectPath, compare.Commits, CompareFiles(compare), filter.WithScope(opts.Paths))
+	if err != nil {
+		return nil, err
+	}
+
+	verification.BehindCommits = len(required)
+	verification.checkBehind(len(compare.Diffs), opts.MaxBehindCommits)
+	return verification, nil
+}
+
+// checkBehind allows the target branch if it has no differences from the default branch
+// or misses at most maxBehind required commits, the reason is set if a maximum is configured
+func (v *Verification) checkBehind(diffs, maxBehind int) {
+	v.Allowed = diffs == 0 || v.BehindCommits <= maxBehind
+	if !v.Allowed && maxBehind > 0 {
+		v.Reason = fmt.Sprintf("%s is %d commits behind %s, maximum is %d",
+			v.TargetRef, v.BehindCommits, v.BaseRef, maxBehind)
+	}
+}
+
+// UnknownDeploymentError is returned by CheckRollback if the deployed pipeline
+// can't be parsed or doesn't exist, so there is nothing to compare with
+type UnknownDeploymentError struct {
+	URL string
+	Err error
+}
+
+func (e *UnknownDeploymentError) Error() string {
+	return fmt.Sprintf("deployed pipeline %q is unknown: %v", e.URL, e.Err)
+}
+
+func (e *UnknownDeploymentError) Unwrap() error {
+	return e.Err
+}
+
+// CheckRollback compares the pipeline being deployed with the currently deployed one.
+// The reason is returned if the target commit is an ancestor of the deployed commit
+// or the pipeline is older than the deployed pipeline, empty string otherwise.
+// Pipelines of different projects are not compared.
+func CheckRollback(deployedAnnotation, targetAnnotation string) (string, error) {
+	deployedHost, deployedProject, deployedNumber, err := ParsePipelineURL(deployedAnnotation)
+	if err != nil {
+		return "", &UnknownDeploymentError{URL: deployedAnnotation, Err: err}
 	}
+	host, projectPath, pipelineNumber, err := ParsePipelineURL(targetAnnotation)
+	if err != nil {
+		return "", err
+	}
+	if deployedHost != host || deployedProject != projectPath || deployedNumber == pipelineNumber {
+		return "", nil
+	}
+
+	deployed, err := GetPipeline(host, projectPath, deployedNumber)
+	if isNotFound(err) {
+		return "", &UnknownDeploymentError{URL: deployedAnnotation, Err: err}
+	}
+	if err != nil {
+		return "", err
+	}
+	target, err := GetPipeline(host, projectPath, pipelineNumber)
+	if err != nil {
+		return "", err
+	}
+	if deployed.SHA == target.SHA {
+		return "", nil
+	}
+
+	refs := []string{target.SHA, deployed.SHA}
+	mergeBase, _, err := host.Client.Repositories.MergeBase(projectPath, &gitlab.MergeBaseOptions{Ref: &refs})
+	if err != nil {
+		return "", err
+	}
+	if mergeBase.ID == target.SHA {
+		return fmt.Sprintf("commit %s of pipeline %d is an ancestor of deployed commit %s of pipeline %d",
+			target.SHA, target.ID, deployed.SHA, deployed.ID), nil
+	}
+
+	if target.CreatedAt != nil && deployed.CreatedAt != nil && target.CreatedAt.Before(*deployed.CreatedAt) {
+		return fmt.Sprintf("pipeline %d is older than deployed pipeline %d", target.ID, deployed.ID), nil
+	}
+	return "", nil
+}
+
+// maxCommitDiffs bounds diffs of commits RequiredCommits requests per call,
+// commits whose files are not known then are required
+const maxCommitDiffs = 50
+
+// compareDiffsLimit is the number of compare diffs GitLab may truncate the result at
+const compareDiffsLimit = 1000
+
+// RequiredCommits returns commits that are not ignored by the filter.
+// changed are files changed by all the commits, e.g. diffs of the compare, nil if unknown.
+// If none of them is required, files of the commits are not requested,
+// otherwise they are requested for at most maxCommitDiffs commits and cached.
+func RequiredCommits(host *client.Host, projectPath string, compareCommits []*gitlab.Commit, changed []string, filter *commits.Filter) ([]*gitlab.Commit, error) {
+	if filter.Empty() {
+		return compareCommits, nil
+	}
+	pathsIgnored := changed != nil && filter.IgnoredFiles(changed)
+
+	var required []*gitlab.Commit
+	requested := 0
+	for _, commit := range compareCommits {
+		sha := commit.ID
+		candidate := commits.Commit{
+			AuthorName:  commit.AuthorName,
+			AuthorEmail: commit.AuthorEmail,
+			Message:     commit.Message,
+		}
+		switch {
+		case pathsIgnored:
+			candidate.Files = func() ([]string, error) { return nil, nil }
+		case requested < maxCommitDiffs:
+			candidate.Files = func() ([]string, error) {
+				files, cached := cachedCommitFiles(host, projectPath, sha)
+				if cached {
+					return files, nil
+				}
+				requested++
+				files, err := GetCommitFiles(host, projectPath, sha)
+				if err != nil {
+					return nil, err
+				}
+				cacheCommitFiles(host, projectPath, sha, files)
+				return files, nil
+			}
+		}
+		ignored, err := filter.Ignored(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if !ignored {
+			required = append(required, commit)
+		}
+	}
+	return required, nil
+}
+
+// CompareFiles returns files changed by the compare, nil is returned
+// if the compare timed out or its diffs may be truncated
+func CompareFiles(compare *gitlab.Compare) []string {
+	if compare.CompareTimeout || len(compare.Diffs) >= compareDiffsLimit {
+		return nil
+	}
+	files := make([]string, 0, len(compare.Diffs))
+	for _, diff := range compare.Diffs {
+		files = append(files, diff.NewPath)
+		if diff.RenamedFile {
+			files = append(files, diff.OldPath)
+		}
+	}
+	return files
+}
 
-	if len(compare.Diffs) > 0 {
-		return false, nil
+// GetCommitFiles returns paths changed by the commit
+func GetCommitFiles(host *client.Host, projectPath, sha string) ([]string, error) {
+	opts := &gitlab.GetCommitDiffOptions{PerPage: 100}
+	var files []string
+	for {
+		diffs, resp, err := host.Client.Commits.GetCommitDiff(projectPath, sha, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, diff := range diffs {
+			files = append(files, diff.NewPath)
+			if diff.RenamedFile {
+				files = append(files, diff.OldPath)
+			}
+		}
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opts.Page = resp.NextPage
 	}
-	return true, nil
 }
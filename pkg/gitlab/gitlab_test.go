@@ -0,0 +1,79 @@
+package gitlab
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alex123012/gitdeps/pkg/commits"
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestVerificationCheckBehind(t *testing.T) {
+	tests := []struct {
+		name       string
+		behind     int
+		diffs      int
+		maxBehind  int
+		wantAllow  bool
+		wantReason string
+	}{
+		{name: "up to date", behind: 0, diffs: 3, wantAllow: true},
+		{name: "behind without limit", behind: 2, diffs: 3},
+		{name: "behind within limit", behind: 2, diffs: 3, maxBehind: 2, wantAllow: true},
+		{name: "behind over limit", behind: 3, diffs: 3, maxBehind: 2, wantReason: "feature is 3 commits behind main, maximum is 2"},
+		{name: "no differences", behind: 5, diffs: 0, maxBehind: 2, wantAllow: true},
+		{name: "ignored commits only", behind: 0, diffs: 1, wantAllow: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verification := &Verification{TargetRef: "feature", BaseRef: "main", BehindCommits: tt.behind}
+			verification.checkBehind(tt.diffs, tt.maxBehind)
+			if verification.Allowed != tt.wantAllow || verification.Reason != tt.wantReason {
+				t.Errorf("checkBehind() = %v, %q, want %v, %q", verification.Allowed, verification.Reason, tt.wantAllow, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRequiredCommitsIgnoredByCompareFiles(t *testing.T) {
+	filter, err := commits.NewFilter(config.IgnoreCommitsConf{Paths: []string{"docs/**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare := &gitlab.Compare{
+		Commits: []*gitlab.Commit{{ID: "a"}, {ID: "b"}},
+		Diffs:   []*gitlab.Diff{{NewPath: "docs/index.md"}, {NewPath: "docs/api.md", OldPath: "docs/old.md", RenamedFile: true}},
+	}
+	// files of the commits are not requested, so no host is needed
+	required, err := RequiredCommits(nil, "group/app", compare.Commits, CompareFiles(compare), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(required) != 0 {
+		t.Errorf("RequiredCommits() = %d commits, want none", len(required))
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		compare *gitlab.Compare
+		want    []string
+	}{
+		{
+			name:    "renamed file",
+			compare: &gitlab.Compare{Diffs: []*gitlab.Diff{{NewPath: "a.go"}, {NewPath: "c.go", OldPath: "b.go", RenamedFile: true}}},
+			want:    []string{"a.go", "c.go", "b.go"},
+		},
+		{name: "timeout", compare: &gitlab.Compare{CompareTimeout: true, Diffs: []*gitlab.Diff{{NewPath: "a.go"}}}},
+		{name: "truncated", compare: &gitlab.Compare{Diffs: make([]*gitlab.Diff, compareDiffsLimit)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompareFiles(tt.compare); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompareFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package gitlab
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alex123012/gitdeps/pkg/client"
+	"github.com/xanzy/go-gitlab"
+)
+
+// GetPipelineJobs returns the latest attempts of every job of the pipeline
+func GetPipelineJobs(host *client.Host, projectPath string, pipelineNumber int) ([]*gitlab.Job, error) {
+	opts := &gitlab.ListJobsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}
+	var jobs []*gitlab.Job
+	for {
+		page, resp, err := host.Client.Jobs.ListPipelineJobs(projectPath, pipelineNumber, opts)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, page...)
+		if resp.NextPage == 0 {
+			return jobs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// CheckPipelineJobs returns why the pipeline from annotationValue doesn't satisfy
+// the requirements, empty string is returned if it does.
+// The pipeline is running while its deploy job runs, so with requireSuccess
+// a running pipeline is accepted if every job in stages before the first running job
+// has succeeded and none of its jobs failed or were canceled,
+// including jobs that are allowed to fail. requiredJobs must have succeeded.
+func CheckPipelineJobs(annotationValue string, requireSuccess bool, requiredJobs []string) (string, error) {
+	if !requireSuccess && len(requiredJobs) == 0 {
+		return "", nil
+	}
+
+	host, projectPath, pipelineNumber, err := ParsePipelineURL(annotationValue)
+	if err != nil {
+		return "", err
+	}
+
+	if requireSuccess {
+		pipeline, err := GetPipeline(host, projectPath, pipelineNumber)
+		if err != nil {
+			return "", err
+		}
+		if pipeline.Status != "success" && pipeline.Status != "running" {
+			return fmt.Sprintf("pipeline %d is %s", pipelineNumber, pipeline.Status), nil
+		}
+	}
+
+	jobs, err := GetPipelineJobs(host, projectPath, pipelineNumber)
+	if err != nil {
+		return "", err
+	}
+
+	if requireSuccess {
+		if reason := unsuccessfulJobs(jobs, pipelineNumber); reason != "" {
+			return reason, nil
+		}
+	}
+
+	for _, name := range requiredJobs {
+		found := false
+		for _, job := range jobs {
+			if job.Name != name {
+				continue
+			}
+			found = true
+			if job.Status != "success" {
+				return fmt.Sprintf("required job %q of pipeline %d is %s", name, pipelineNumber, job.Status), nil
+			}
+		}
+		if !found {
+			return fmt.Sprintf("required job %q is not found in pipeline %d", name, pipelineNumber), nil
+		}
+	}
+	return "", nil
+}
+
+// unsuccessfulJobs returns why the jobs don't satisfy require_success, empty string otherwise.
+// Stages are ordered by their first job id, every job in stages before the stage
+// of the first running job must be successful or skipped. Manual jobs that are allowed
+// to fail are optional and may be not started. Finished pipelines have no running jobs.
+func unsuccessfulJobs(jobs []*gitlab.Job, pipelineNumber int) string {
+	for _, job := range jobs {
+		if job.Status == "failed" || job.Status == "canceled" {
+			return fmt.Sprintf("job %q of pipeline %d is %s", job.Name, pipelineNumber, job.Status)
+		}
+	}
+
+	sorted := make([]*gitlab.Job, len(jobs))
+	copy(sorted, jobs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	stages := make(map[string]int)
+	for _, job := range sorted {
+		if _, ok := stages[job.Stage]; !ok {
+			stages[job.Stage] = len(stages)
+		}
+	}
+
+	deployStage := len(stages)
+	for _, job := range sorted {
+		if job.Status == "running" && stages[job.Stage] < deployStage {
+			deployStage = stages[job.Stage]
+		}
+	}
+	for _, job := range sorted {
+		if stages[job.Stage] >= deployStage || job.Status == "success" || job.Status == "skipped" || job.Status == "manual" && job.AllowFailure {
+			continue
+		}
+		return fmt.Sprintf("job %q of stage %q of pipeline %d is %s", job.Name, job.Stage, pipelineNumber, job.Status)
+	}
+	return ""
+}
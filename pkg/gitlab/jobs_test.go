@@ -0,0 +1,80 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestUnsuccessfulJobs(t *testing.T) {
+	tests := []struct {
+		name string
+		jobs []*gitlab.Job
+		want string
+	}{
+		{
+			name: "previous stages succeeded",
+			jobs: []*gitlab.Job{
+				{ID: 1, Name: "build", Stage: "build", Status: "success"},
+				{ID: 2, Name: "test", Stage: "test", Status: "success"},
+				{ID: 3, Name: "deploy", Stage: "deploy", Status: "running"},
+				{ID: 4, Name: "smoke", Stage: "verify", Status: "created"},
+			},
+		},
+		{
+			name: "test is pending",
+			jobs: []*gitlab.Job{
+				{ID: 1, Name: "build", Stage: "build", Status: "success"},
+				{ID: 2, Name: "test", Stage: "test", Status: "pending"},
+				{ID: 3, Name: "deploy", Stage: "deploy", Status: "running"},
+			},
+			want: `job "test" of stage "test" of pipeline 7 is pending`,
+		},
+		{
+			name: "test is created, jobs are listed newest first",
+			jobs: []*gitlab.Job{
+				{ID: 3, Name: "deploy", Stage: "deploy", Status: "running"},
+				{ID: 2, Name: "test", Stage: "test", Status: "created"},
+				{ID: 1, Name: "build", Stage: "build", Status: "success"},
+			},
+			want: `job "test" of stage "test" of pipeline 7 is created`,
+		},
+		{
+			name: "optional manual job",
+			jobs: []*gitlab.Job{
+				{ID: 1, Name: "cleanup", Stage: "build", Status: "manual", AllowFailure: true},
+				{ID: 2, Name: "deploy", Stage: "deploy", Status: "running"},
+			},
+		},
+		{
+			name: "failed job allowed to fail",
+			jobs: []*gitlab.Job{
+				{ID: 1, Name: "lint", Stage: "test", Status: "failed", AllowFailure: true},
+				{ID: 2, Name: "deploy", Stage: "deploy", Status: "running"},
+			},
+			want: `job "lint" of pipeline 7 is failed`,
+		},
+		{
+			name: "skipped job",
+			jobs: []*gitlab.Job{
+				{ID: 1, Name: "build", Stage: "build", Status: "success"},
+				{ID: 2, Name: "notify", Stage: "build", Status: "skipped"},
+				{ID: 3, Name: "deploy", Stage: "deploy", Status: "running"},
+			},
+		},
+		{
+			name: "finished pipeline",
+			jobs: []*gitlab.Job{
+				{ID: 1, Name: "build", Stage: "build", Status: "success"},
+				{ID: 2, Name: "deploy", Stage: "deploy", Status: "success"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unsuccessfulJobs(tt.jobs, 7); got != tt.want {
+				t.Errorf("unsuccessfulJobs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/client"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/xanzy/go-gitlab"
+)
+
+// SubmodulesFile is the submodules configuration path in the project repository
+const SubmodulesFile = ".gitmodules"
+
+// CheckSubmodules returns why a submodule commit pinned at sha of the project
+// from annotationValue is not reachable from the default branch of the submodule project,
+// empty string is returned if every pinned commit is or the project has no submodules
+func CheckSubmodules(annotationValue, sha string) (string, error) {
+	host, projectPath, _, err := ParsePipelineURL(annotationValue)
+	if err != nil {
+		return "", err
+	}
+	data, found, err := GetRawFile(host, projectPath, SubmodulesFile, sha)
+	if err != nil || !found {
+		return "", err
+	}
+	modules := gitconfig.NewModules()
+	if err := modules.Unmarshal(data); err != nil {
+		return "", fmt.Errorf("not valid %s of %s: %w", SubmodulesFile, projectPath, err)
+	}
+
+	names := make([]string, 0, len(modules.Submodules))
+	for name := range modules.Submodules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		module := modules.Submodules[name]
+		pinned, err := GetSubmoduleCommit(host, projectPath, module.Path, sha)
+		if err != nil {
+			return "", err
+		}
+		submoduleHost, submoduleProject, err := SubmoduleProject(host, projectPath, module.URL)
+		if err != nil {
+			return "", err
+		}
+		defaultBranch, err := GetDefaultBranch(submoduleHost, submoduleProject)
+		if err != nil {
+			return "", err
+		}
+		head, err := GetBranchHead(submoduleHost, submoduleProject, defaultBranch)
+		if err != nil {
+			return "", err
+		}
+		contains, err := ContainsCommit(submoduleHost, submoduleProject, head, pinned)
+		if err != nil {
+			return "", err
+		}
+		if !contains {
+			return fmt.Sprintf("submodule %s pins %s which is not in default branch %s of %s",
+				module.Path, pinned, defaultBranch, submoduleProject), nil
+		}
+	}
+	return "", nil
+}
+
+// GetSubmoduleCommit returns the commit the submodule at submodulePath is pinned to at ref
+func GetSubmoduleCommit(host *client.Host, projectPath, submodulePath, ref string) (string, error) {
+	opts := &gitlab.ListTreeOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+		Ref:         &ref,
+	}
+	if dir := path.Dir(submodulePath); dir != "." {
+		opts.Path = &dir
+	}
+	for {
+		nodes, resp, err := host.Client.Repositories.ListTree(projectPath, opts)
+		if err != nil {
+			return "", err
+		}
+		for _, node := range nodes {
+			if node.Path == submodulePath && node.Type == "commit" {
+				return node.ID, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return "", fmt.Errorf("submodule %s is not found in %s at %s", submodulePath, projectPath, ref)
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// SubmoduleProject returns configured host and project path of the submodule url,
+// relative urls are resolved against the project
+func SubmoduleProject(host *client.Host, projectPath, submoduleURL string) (*client.Host, string, error) {
+	if strings.HasPrefix(submoduleURL, "./") || strings.HasPrefix(submoduleURL, "../") {
+		return host, strings.TrimSuffix(path.Join(projectPath, submoduleURL), ".git"), nil
+	}
+
+	var hostname, submodulePath string
+	if u, err := url.Parse(submoduleURL); err == nil && u.Host != "" {
+		hostname, submodulePath = u.Hostname(), u.Path
+	} else if address, scpPath, ok := strings.Cut(submoduleURL, ":"); ok {
+		// scp-like syntax: git@gitlab.example.com:group/project.git
+		_, hostname, _ = strings.Cut(address, "@")
+		if hostname == "" {
+			hostname = address
+		}
+		submodulePath = scpPath
+	} else {
+		return nil, "", fmt.Errorf("not valid submodule url %q", submoduleURL)
+	}
+
+	submoduleHost, found := common.Client.Hosts.GetHost(hostname)
+	if !found {
+		return nil, "", fmt.Errorf("host %s of submodule url %q is not configured", hostname, submoduleURL)
+	}
+	return submoduleHost, strings.TrimSuffix(strings.Trim(submodulePath, "/"), ".git"), nil
+}
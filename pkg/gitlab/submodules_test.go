@@ -0,0 +1,60 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/alex123012/gitdeps/cmd/common"
+	"github.com/alex123012/gitdeps/pkg/client"
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+func TestSubmoduleProject(t *testing.T) {
+	gitlabClient, err := client.NewClient(&config.Config{Hosts: map[string]config.Host{
+		"main":  {URL: "https://gitlab.example.com", Token: "token"},
+		"other": {URL: "https://git.example.org", Token: "token"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := common.Client
+	common.Client = gitlabClient
+	defer func() { common.Client = previous }()
+
+	host, _ := gitlabClient.Hosts.GetHost("gitlab.example.com")
+	other, _ := gitlabClient.Hosts.GetHost("git.example.org")
+
+	tests := []struct {
+		name        string
+		url         string
+		wantHost    *client.Host
+		wantProject string
+		wantErr     bool
+	}{
+		{name: "relative sibling", url: "../lib.git", wantHost: host, wantProject: "group/lib"},
+		{name: "relative parent group", url: "../../shared/lib", wantHost: host, wantProject: "shared/lib"},
+		{name: "relative child", url: "./lib", wantHost: host, wantProject: "group/app/lib"},
+		{name: "https", url: "https://gitlab.example.com/group/lib.git", wantHost: host, wantProject: "group/lib"},
+		{name: "https other host", url: "https://git.example.org/team/sub/lib", wantHost: other, wantProject: "team/sub/lib"},
+		{name: "ssh with port", url: "ssh://git@gitlab.example.com:2222/group/lib.git", wantHost: host, wantProject: "group/lib"},
+		{name: "scp", url: "git@gitlab.example.com:group/lib.git", wantHost: host, wantProject: "group/lib"},
+		{name: "scp without user", url: "git.example.org:team/lib", wantHost: other, wantProject: "team/lib"},
+		{name: "unknown host", url: "https://github.com/group/lib.git", wantErr: true},
+		{name: "unknown scp host", url: "git@github.com:group/lib.git", wantErr: true},
+		{name: "not valid", url: "lib", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotHost, gotProject, err := SubmoduleProject(host, "group/app", tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubmoduleProject(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotHost != tt.wantHost || gotProject != tt.wantProject {
+				t.Errorf("SubmoduleProject(%q) = %s %q, want %s %q",
+					tt.url, gotHost.URL, gotProject, tt.wantHost.URL, tt.wantProject)
+			}
+		})
+	}
+}
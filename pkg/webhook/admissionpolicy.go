@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// AdmissionPolicyAPIVersions are supported ValidatingAdmissionPolicy versions,
+// v1beta1 is served since Kubernetes 1.28 and v1 since 1.30
+var AdmissionPolicyAPIVersions = []string{"v1", "v1beta1"}
+
+// admissionPolicyResources are resource names of the admission policy kinds
+var admissionPolicyResources = map[string]string{
+	"ValidatingAdmissionPolicy":        "validatingadmissionpolicies",
+	"ValidatingAdmissionPolicyBinding": "validatingadmissionpolicybindings",
+}
+
+// AllowedHosts returns hosts allowed in the pipeline url annotation
+func AllowedHosts(cfg config.Config) ([]string, error) {
+	if len(cfg.WebhookConf.AdmissionPolicy.AllowedHosts) > 0 {
+		return cfg.WebhookConf.AdmissionPolicy.AllowedHosts, nil
+	}
+	hosts := make([]string, 0, len(cfg.Hosts))
+	for name, host := range cfg.Hosts {
+		hostUrl, err := url.Parse(host.URL)
+		if err != nil {
+			return nil, fmt.Errorf("not valid url of host %q: %w", name, err)
+		}
+		if hostUrl.Host == "" {
+			return nil, fmt.Errorf("not valid url of host %q: %q", name, host.URL)
+		}
+		hosts = append(hosts, hostUrl.Host)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no allowed hosts, set admission_policy.allowed_hosts or hosts in config")
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// AdmissionPolicyName returns name of the ValidatingAdmissionPolicy and its binding
+func AdmissionPolicyName(WebhookConf config.WebHookConf) string {
+	if WebhookConf.AdmissionPolicy.Name != "" {
+		return WebhookConf.AdmissionPolicy.Name
+	}
+	return WebhookConf.Metadata.Name
+}
+
+// PipelineURLPattern returns regular expression that matches pipeline urls of the hosts
+func PipelineURLPattern(hosts []string) string {
+	quoted := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		quoted = append(quoted, regexp.QuoteMeta(host))
+	}
+	return fmt.Sprintf("^https?://(%s)/.+/-/pipelines/[0-9]+$", strings.Join(quoted, "|"))
+}
+
+// ValidatingAdmissionPolicy returns in-tree policy that requires the pipeline url annotation
+// from one of the allowed hosts on objects matched by the webhook rules and policies.
+// Typed admission policies are not available in the used client-go version,
+// so the policy is built as unstructured object.
+func ValidatingAdmissionPolicy(WebhookConf config.WebHookConf, allowedHosts []string, apiVersion string) (*unstructured.Unstructured, error) {
+	if err := checkAdmissionPolicyAPIVersion(apiVersion); err != nil {
+		return nil, err
+	}
+
+	var resourceRules []interface{}
+	for _, webhook := range ValidatingWebhooks(WebhookConf) {
+		for _, rule := range webhook.Rules {
+			operations := make([]v1.OperationType, 0, len(rule.Operations))
+			for _, operation := range rule.Operations {
+				if operation != v1.Delete && operation != v1.Connect {
+					operations = append(operations, operation)
+				}
+			}
+			if len(operations) == 0 {
+				continue
+			}
+			rule.Operations = operations
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&rule)
+			if err != nil {
+				return nil, err
+			}
+			if !containsRule(resourceRules, content) {
+				resourceRules = append(resourceRules, content)
+			}
+		}
+	}
+	if len(resourceRules) == 0 {
+		return nil, fmt.Errorf("no CREATE or UPDATE rules in webhooks to build admission policy from")
+	}
+
+	namespaceSelector, objectSelector := policySelectors(WebhookConf, WebhookConf.Policies)
+	matchConstraints := map[string]interface{}{
+		"resourceRules": resourceRules,
+	}
+	selector, err := runtime.DefaultUnstructuredConverter.ToUnstructured(namespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	matchConstraints["namespaceSelector"] = selector
+	if objectSelector != nil {
+		selector, err := runtime.DefaultUnstructuredConverter.ToUnstructured(objectSelector)
+		if err != nil {
+			return nil, err
+		}
+		matchConstraints["objectSelector"] = selector
+	}
+
+	failurePolicy := WebhookConf.AdmissionPolicy.FailurePolicy
+	if failurePolicy == "" {
+		failurePolicy = string(v1.Fail)
+	}
+
+	annotation := fmt.Sprintf("object.metadata.annotations['%s']", PipelineURLAnnotation)
+	hasAnnotation := fmt.Sprintf("has(object.metadata.annotations) && '%s' in object.metadata.annotations", PipelineURLAnnotation)
+	spec := map[string]interface{}{
+		"failurePolicy":    failurePolicy,
+		"matchConstraints": matchConstraints,
+		"validations": []interface{}{
+			map[string]interface{}{
+				"expression": hasAnnotation,
+				"message":    fmt.Sprintf("%s annotation is required", PipelineURLAnnotation),
+				"reason":     "Invalid",
+			},
+			map[string]interface{}{
+				"expression": fmt.Sprintf("!(%s) || %s.matches('%s')", hasAnnotation, annotation, celEscape(PipelineURLPattern(allowedHosts))),
+				"message": fmt.Sprintf("%s annotation must be a pipeline url from one of the hosts: %s",
+					PipelineURLAnnotation, strings.Join(allowedHosts, ", ")),
+				"reason": "Invalid",
+			},
+		},
+	}
+	if condition := policiesCondition(WebhookConf.Policies, hasAnnotation); condition != "" {
+		spec["matchConditions"] = []interface{}{
+			map[string]interface{}{
+				"name":       "policies",
+				"expression": condition,
+			},
+		}
+	}
+
+	return admissionPolicyObject(WebhookConf, apiVersion, "ValidatingAdmissionPolicy", spec), nil
+}
+
+// ValidatingAdmissionPolicyBinding returns binding of the policy from ValidatingAdmissionPolicy
+func ValidatingAdmissionPolicyBinding(WebhookConf config.WebHookConf, apiVersion string) (*unstructured.Unstructured, error) {
+	if err := checkAdmissionPolicyAPIVersion(apiVersion); err != nil {
+		return nil, err
+	}
+	actions := WebhookConf.AdmissionPolicy.ValidationActions
+	if len(actions) == 0 {
+		actions = []string{"Deny"}
+	}
+	validationActions := make([]interface{}, 0, len(actions))
+	for _, action := range actions {
+		validationActions = append(validationActions, action)
+	}
+	spec := map[string]interface{}{
+		"policyName":        AdmissionPolicyName(WebhookConf),
+		"validationActions": validationActions,
+	}
+	return admissionPolicyObject(WebhookConf, apiVersion, "ValidatingAdmissionPolicyBinding", spec), nil
+}
+
+// AdmissionPolicyResource returns resource of the policy or binding object
+func AdmissionPolicyResource(object *unstructured.Unstructured) (schema.GroupVersionResource, error) {
+	resource, ok := admissionPolicyResources[object.GetKind()]
+	if !ok {
+		return schema.GroupVersionResource{}, fmt.Errorf("not valid admission policy kind %q", object.GetKind())
+	}
+	return object.GroupVersionKind().GroupVersion().WithResource(resource), nil
+}
+
+func admissionPolicyObject(WebhookConf config.WebHookConf, apiVersion, kind string, spec map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	object.SetAPIVersion(fmt.Sprintf("%s/%s", v1.GroupName, apiVersion))
+	object.SetKind(kind)
+	object.SetName(AdmissionPolicyName(WebhookConf))
+	object.SetLabels(webhookMetadata(WebhookConf).Labels)
+	return object
+}
+
+// policiesCondition returns CEL expression that matches objects selected by any of the policies,
+// empty string is returned if every object is selected
+func policiesCondition(policies []config.Policy, hasAnnotation string) string {
+	conditions := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		var parts []string
+		if len(policy.Namespaces) > 0 {
+			namespaces := make([]string, 0, len(policy.Namespaces))
+			for _, namespace := range policy.Namespaces {
+				namespaces = append(namespaces, fmt.Sprintf("'%s'", celEscape(namespace)))
+			}
+			parts = append(parts, fmt.Sprintf("request.namespace in [%s]", strings.Join(namespaces, ", ")))
+		}
+		switch policy.Selection {
+		case SelectLabel:
+			parts = append(parts, fmt.Sprintf("(has(object.metadata.labels) && '%s' in object.metadata.labels && object.metadata.labels['%s'] == 'true')", EnforceLabel, EnforceLabel))
+		case SelectAnnotation:
+			parts = append(parts, fmt.Sprintf("(%s)", hasAnnotation))
+		}
+		if len(parts) == 0 {
+			return ""
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s)", strings.Join(parts, " && ")))
+	}
+	return strings.Join(conditions, " || ")
+}
+
+func containsRule(rules []interface{}, rule map[string]interface{}) bool {
+	for _, r := range rules {
+		if reflect.DeepEqual(r, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkAdmissionPolicyAPIVersion(apiVersion string) error {
+	if !contains(AdmissionPolicyAPIVersions, apiVersion) {
+		return fmt.Errorf("not valid admission policy api version %q, use one of [%s]", apiVersion, strings.Join(AdmissionPolicyAPIVersions, ", "))
+	}
+	return nil
+}
+
+// celEscape escapes string to be used in single quoted CEL string literal
+func celEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+func TestAdmissionPolicyResource(t *testing.T) {
+	conf := config.WebHookConf{}
+	conf.Metadata.Name = "gitdeps"
+	tests := []struct {
+		apiVersion string
+		kind       string
+		want       string
+	}{
+		{apiVersion: "v1", kind: "ValidatingAdmissionPolicy", want: "admissionregistration.k8s.io/v1, Resource=validatingadmissionpolicies"},
+		{apiVersion: "v1", kind: "ValidatingAdmissionPolicyBinding", want: "admissionregistration.k8s.io/v1, Resource=validatingadmissionpolicybindings"},
+		{apiVersion: "v1beta1", kind: "ValidatingAdmissionPolicy", want: "admissionregistration.k8s.io/v1beta1, Resource=validatingadmissionpolicies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			object := admissionPolicyObject(conf, tt.apiVersion, tt.kind, map[string]interface{}{})
+			resource, err := AdmissionPolicyResource(object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resource.String(); got != tt.want {
+				t.Errorf("AdmissionPolicyResource() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
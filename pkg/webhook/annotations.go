@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/gitlab"
+)
+
+const (
+	PipelineURLAnnotation = "gitlab.ci.werf.io/pipeline-url"
+
+	annotationPrefix     = "gitdeps.io/"
+	ProjectAnnotation    = annotationPrefix + "project"
+	TargetSHAAnnotation  = annotationPrefix + "target-sha"
+	BaseRefAnnotation    = annotationPrefix + "base-ref"
+	BaseSHAAnnotation    = annotationPrefix + "base-sha"
+	VerifiedAtAnnotation = annotationPrefix + "verified-at"
+	PolicyAnnotation     = annotationPrefix + "policy"
+
+	// AllowRollbackAnnotation allows an intentional rollback to the deploy named by its value,
+	// see OverrideApplies. The value is recorded in the audit log
+	AllowRollbackAnnotation = annotationPrefix + "allow-rollback"
+	// PathsAnnotation is comma separated path globs of the component in a monorepo,
+	// it is used only if the policy allows it
+	PathsAnnotation = annotationPrefix + "paths"
+	// FreezeOverrideAnnotation allows an emergency deploy named by its value during freeze windows
+	// if the policy allows it, see OverrideApplies. The value is recorded in the audit log
+	FreezeOverrideAnnotation = annotationPrefix + "freeze-override"
+)
+
+// minOverrideSHALength is the shortest abbreviated commit sha accepted by OverrideApplies
+const minOverrideSHALength = 7
+
+// OverrideApplies reports whether the override annotation value names the deploy:
+// its pipeline url or the target commit sha, possibly abbreviated.
+// An annotation left on the object from an earlier deploy doesn't apply to the next ones
+func OverrideApplies(value, pipelineURL, targetSHA string) bool {
+	if value == "" {
+		return false
+	}
+	if value == pipelineURL {
+		return true
+	}
+	return len(value) >= minOverrideSHALength && targetSHA != "" && strings.HasPrefix(targetSHA, value)
+}
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// VerificationAnnotations returns annotations describing what was verified for the object
+func VerificationAnnotations(verification *gitlab.Verification, policy string, verifiedAt time.Time) map[string]string {
+	return map[string]string{
+		ProjectAnnotation:    verification.ProjectPath,
+		TargetSHAAnnotation:  verification.TargetSHA,
+		BaseRefAnnotation:    verification.BaseRef,
+		BaseSHAAnnotation:    verification.BaseSHA,
+		VerifiedAtAnnotation: verifiedAt.UTC().Format(time.RFC3339),
+		PolicyAnnotation:     policy,
+	}
+}
+
+// AnnotationsPatch returns JSONPatch that sets annotations
+// on the object which currently has the current annotations
+func AnnotationsPatch(current, annotations map[string]string) ([]byte, error) {
+	if len(current) == 0 {
+		return json.Marshal([]patchOperation{{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: annotations,
+		}})
+	}
+
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	patch := make([]patchOperation, 0, len(keys))
+	for _, key := range keys {
+		patch = append(patch, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/" + escapeJSONPointer(key),
+			Value: annotations[key],
+		})
+	}
+	return json.Marshal(patch)
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,29 @@
+package webhook
+
+import "testing"
+
+func TestOverrideApplies(t *testing.T) {
+	pipelineURL := "https://gitlab.example.com/group/app/-/pipelines/42"
+	sha := "0a1b2c3d4e5f60718293a4b5c6d7e8f901234567"
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "empty", value: "", want: false},
+		{name: "pipeline url", value: pipelineURL, want: true},
+		{name: "commit sha", value: sha, want: true},
+		{name: "abbreviated sha", value: sha[:8], want: true},
+		{name: "too short sha", value: sha[:4], want: false},
+		{name: "previous pipeline url", value: "https://gitlab.example.com/group/app/-/pipelines/41", want: false},
+		{name: "other sha", value: "ffffffff", want: false},
+		{name: "any value", value: "true", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OverrideApplies(tt.value, pipelineURL, sha); got != tt.want {
+				t.Errorf("OverrideApplies(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
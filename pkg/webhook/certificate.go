@@ -0,0 +1,443 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+const (
+	CertificateFileMode os.FileMode = 0644
+	PrivateKeyFileMode  os.FileMode = 0600
+)
+
+func GenerateCertificate(WebhookConf config.WebHookConf, toFile bool) (map[string]*bytes.Buffer, error) {
+	certsPath := WebhookConf.Tls.Path
+	certificateFile := path.Join(certsPath, WebhookConf.Tls.CertFile)
+	keyFile := path.Join(certsPath, WebhookConf.Tls.KeyFile)
+	if toFile {
+		if _, err := os.Stat(certificateFile); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("not valid certificate path: %w", err)
+		}
+		if _, err := os.Stat(keyFile); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("not valid key path: %w", err)
+		}
+	}
+
+	caPEM, caPrivKeyPEM, err := GenerateCA(WebhookConf)
+	if err != nil {
+		return nil, err
+	}
+
+	serverCertPEM, serverPrivKeyPEM, err := SignServerCertificate(WebhookConf, caPEM.Bytes(), caPrivKeyPEM.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if toFile {
+		err = os.MkdirAll(certsPath, 0666)
+		if err != nil {
+			return nil, err
+		}
+		err = WriteFile(certificateFile, serverCertPEM, CertificateFileMode)
+		if err != nil {
+			return nil, err
+		}
+
+		err = WriteFile(keyFile, serverPrivKeyPEM, PrivateKeyFileMode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return map[string]*bytes.Buffer{
+		"ca":     caPEM,
+		"ca-key": caPrivKeyPEM,
+		"cert":   serverCertPEM,
+		"key":    serverPrivKeyPEM,
+	}, nil
+}
+
+// GenerateCA returns PEM encoded self signed CA certificate and its private key
+func GenerateCA(WebhookConf config.WebHookConf) (*bytes.Buffer, *bytes.Buffer, error) {
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// CA config
+	ca := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{WebhookConf.Tls.Organization},
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              notAfter(WebhookConf),
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	// CA private key
+	caPrivKey, err := GeneratePrivateKey(WebhookConf.Tls.KeyType, WebhookConf.Tls.KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca.SubjectKeyId, err = SubjectKeyID(caPrivKey.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Self signed CA certificate
+	caBytes, err := x509.CreateCertificate(cryptorand.Reader, ca, ca, caPrivKey.Public(), caPrivKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caPEM, err := encodePEM("CERTIFICATE", caBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caPrivKeyPEM, err := EncodePrivateKey(caPrivKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return caPEM, caPrivKeyPEM, nil
+}
+
+// SignServerCertificate returns PEM encoded serving certificate for the webhook service
+// and its private key, signed by the given PEM encoded CA
+func SignServerCertificate(WebhookConf config.WebHookConf, caPEM, caPrivKeyPEM []byte) (*bytes.Buffer, *bytes.Buffer, error) {
+	ca, err := ParseCertificate(caPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	caPrivKey, err := ParsePrivateKey(caPrivKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA private key: %w", err)
+	}
+
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceDNSNames := ServiceDNSNames(WebhookConf)
+	var commonName string
+	if len(serviceDNSNames) > 0 {
+		commonName = serviceDNSNames[len(serviceDNSNames)-1]
+	}
+	dnsNames := append(serviceDNSNames, WebhookConf.Tls.DNSNames...)
+
+	ipAddresses := make([]net.IP, 0, len(WebhookConf.Tls.IPAddresses))
+	for _, address := range WebhookConf.Tls.IPAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("not valid IP address %q", address)
+		}
+		ipAddresses = append(ipAddresses, ip)
+	}
+
+	urlHosts, err := URLHosts(WebhookConf)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, host := range urlHosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if !containsIP(ipAddresses, ip) {
+				ipAddresses = append(ipAddresses, ip)
+			}
+		} else if !contains(dnsNames, host) {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+	if commonName == "" && len(dnsNames) > 0 {
+		commonName = dnsNames[0]
+	}
+
+	// server cert config
+	cert := &x509.Certificate{
+		DNSNames:     dnsNames,
+		IPAddresses:  ipAddresses,
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{WebhookConf.Tls.Organization},
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    notAfter(WebhookConf),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+
+	// server private key
+	serverPrivKey, err := GeneratePrivateKey(WebhookConf.Tls.KeyType, WebhookConf.Tls.KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert.SubjectKeyId, err = SubjectKeyID(serverPrivKey.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// sign the server cert
+	serverCertBytes, err := x509.CreateCertificate(cryptorand.Reader, cert, ca, serverPrivKey.Public(), caPrivKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// PEM encode the  server cert and key
+	serverCertPEM, err := encodePEM("CERTIFICATE", serverCertBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverPrivKeyPEM, err := EncodePrivateKey(serverPrivKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return serverCertPEM, serverPrivKeyPEM, nil
+}
+
+// ServiceDNSNames returns DNS names of the webhook service
+func ServiceDNSNames(WebhookConf config.WebHookConf) []string {
+	service := WebhookConf.Webhook.ClientConfig.Service
+	if service == nil {
+		return nil
+	}
+	nameNamespace := fmt.Sprintf("%s.%s", service.Name, service.Namespace)
+
+	return []string{
+		service.Name,
+		nameNamespace,
+		fmt.Sprintf("%s.svc", nameNamespace),
+	}
+}
+
+// URLHosts returns hosts from url clientConfig of the webhooks
+func URLHosts(WebhookConf config.WebHookConf) ([]string, error) {
+	var urls []string
+	for _, webhook := range ValidatingWebhooks(WebhookConf) {
+		if webhook.ClientConfig.URL != nil {
+			urls = append(urls, *webhook.ClientConfig.URL)
+		}
+	}
+	if WebhookConf.Mutating.Enabled {
+		if mutatingURL := MutatingWebhook(WebhookConf).ClientConfig.URL; mutatingURL != nil {
+			urls = append(urls, *mutatingURL)
+		}
+	}
+
+	var hosts []string
+	for _, rawURL := range urls {
+		webhookURL, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("not valid webhook url %q: %w", rawURL, err)
+		}
+		if host := webhookURL.Hostname(); host != "" && !contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// GeneratePrivateKey returns new private key of the given type: rsa, ecdsa or ed25519.
+// keySize is the modulus size for rsa and the curve size for ecdsa
+func GeneratePrivateKey(keyType string, keySize int) (crypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case "", "rsa":
+		if keySize == 0 {
+			keySize = 4096
+		}
+		if keySize < 2048 {
+			return nil, fmt.Errorf("rsa key size %d is too small, use at least 2048", keySize)
+		}
+		return rsa.GenerateKey(cryptorand.Reader, keySize)
+	case "ecdsa":
+		var curve elliptic.Curve
+		switch keySize {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("not valid ecdsa key size %d, use one of [256, 384, 521]", keySize)
+		}
+		return ecdsa.GenerateKey(curve, cryptorand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(cryptorand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("not valid key type %q, use one of [rsa, ecdsa, ed25519]", keyType)
+}
+
+// EncodePrivateKey returns PEM encoded private key
+func EncodePrivateKey(key crypto.Signer) (*bytes.Buffer, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	case *ecdsa.PrivateKey:
+		data, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return encodePEM("EC PRIVATE KEY", data)
+	default:
+		data, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return encodePEM("PRIVATE KEY", data)
+	}
+}
+
+// ParseCertificate returns the first certificate from PEM data
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	certs, err := ParseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	return certs[0], nil
+}
+
+// ParseCertificates returns all certificates from PEM data
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in PEM data")
+	}
+	return certs, nil
+}
+
+// ParsePrivateKey returns private key from PEM data
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in PEM data")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+// WriteFile writes data in the file at the given path with the given permissions,
+// they are also set if the file already exists
+func WriteFile(filepath string, sCert *bytes.Buffer, perm os.FileMode) error {
+	f, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	_, err = f.Write(sCert.Bytes())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SubjectKeyID returns SHA-1 hash of the subject public key as described in RFC 5280 4.2.1.2,
+// so certificates of different keys have different key identifiers
+func SubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, err
+	}
+	id := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	return id[:], nil
+}
+
+func encodePEM(blockType string, data []byte) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	err := pem.Encode(buf, &pem.Block{
+		Type:  blockType,
+		Bytes: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func notAfter(WebhookConf config.WebHookConf) time.Time {
+	if WebhookConf.Tls.Validity > 0 {
+		return time.Now().Add(WebhookConf.Tls.Validity)
+	}
+	return time.Now().AddDate(1, 0, 0)
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	return cryptorand.Int(cryptorand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
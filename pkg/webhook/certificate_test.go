@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+func TestSubjectKeyID(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType string
+	}{
+		{name: "rsa", keyType: "rsa"},
+		{name: "ecdsa", keyType: "ecdsa"},
+		{name: "ed25519", keyType: "ed25519"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.WebHookConf{}
+			conf.Tls.KeyType = tt.keyType
+			if tt.keyType == "rsa" {
+				conf.Tls.KeySize = 2048
+			}
+			conf.Tls.Validity = 24 * time.Hour
+
+			seen := map[string]string{}
+			for i := 0; i < 2; i++ {
+				caPEM, caKeyPEM, err := GenerateCA(conf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				certPEM, _, err := SignServerCertificate(conf, caPEM.Bytes(), caKeyPEM.Bytes())
+				if err != nil {
+					t.Fatal(err)
+				}
+				for kind, data := range map[string][]byte{"ca": caPEM.Bytes(), "cert": certPEM.Bytes()} {
+					cert, err := ParseCertificate(data)
+					if err != nil {
+						t.Fatal(err)
+					}
+					want, err := SubjectKeyID(cert.PublicKey)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(cert.SubjectKeyId, want) {
+						t.Errorf("%s subject key id = %x, want hash of the public key %x", kind, cert.SubjectKeyId, want)
+					}
+					if other, ok := seen[string(cert.SubjectKeyId)]; ok {
+						t.Errorf("%s has the same subject key id as %s", kind, other)
+					}
+					seen[string(cert.SubjectKeyId)] = kind
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing os.FileMode
+		perm     os.FileMode
+	}{
+		{name: "new certificate", perm: CertificateFileMode},
+		{name: "new private key", perm: PrivateKeyFileMode},
+		{name: "existing readable private key", existing: 0644, perm: PrivateKeyFileMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "file.pem")
+			if tt.existing != 0 {
+				if err := os.WriteFile(file, []byte("old data that is longer"), tt.existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := WriteFile(file, bytes.NewBufferString("data"), tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.perm {
+				t.Errorf("mode = %v, want %v", info.Mode().Perm(), tt.perm)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "data" {
+				t.Errorf("data = %q, want %q", data, "data")
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const CertManagerInjectAnnotation = "cert-manager.io/inject-ca-from"
+
+// CertManagerEnabled reports whether webhook TLS is managed by cert-manager
+func CertManagerEnabled(WebhookConf config.WebHookConf) bool {
+	return WebhookConf.Tls.CertManager.Enabled
+}
+
+// CertManagerCertificate returns "namespace/name" of the cert-manager Certificate,
+// defaults to the webhook service name and namespace
+func CertManagerCertificate(WebhookConf config.WebHookConf) string {
+	if certificate := WebhookConf.Tls.CertManager.Certificate; certificate != "" {
+		return certificate
+	}
+	if service := WebhookConf.Webhook.ClientConfig.Service; service != nil {
+		return fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+	}
+	return ""
+}
+
+// CertManagerCABundle returns CA from the configured CA Secret,
+// nil is returned when the CA should be injected by cert-manager
+func CertManagerCABundle(ctx context.Context, config *rest.Config, WebhookConf config.WebHookConf) (*bytes.Buffer, error) {
+	caSecret := WebhookConf.Tls.CertManager.CASecret
+	if caSecret.Name == "" {
+		return nil, nil
+	}
+
+	namespace := caSecret.Namespace
+	if namespace == "" {
+		namespace = CertificateSecretNamespace(WebhookConf)
+	}
+	api, err := SecretApiFromConfig(config, namespace)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := api.Get(ctx, caSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ca, ok := secret.Data[SecretCACertKey]
+	if !ok || len(ca) == 0 {
+		return nil, fmt.Errorf("secret %s/%s has no %q", namespace, caSecret.Name, SecretCACertKey)
+	}
+	return bytes.NewBuffer(ca), nil
+}
+
+// CertManagerMetadata returns webhook configuration metadata
+// with the cert-manager CA injection annotation
+func CertManagerMetadata(WebhookConf config.WebHookConf) metav1.ObjectMeta {
+	meta := *WebhookConf.Metadata.DeepCopy()
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	meta.Annotations[CertManagerInjectAnnotation] = CertManagerCertificate(WebhookConf)
+	return meta
+}
@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"strings"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ComponentPaths returns monorepo paths of the object from policy components
+// with the policy shared paths, nil is returned if the object is not a component.
+// gitdeps.io/paths annotation replaces the component paths only if the policy allows it,
+// otherwise deployers could exclude every commit with paths that are never changed
+func ComponentPaths(policy *config.Policy, object *unstructured.Unstructured) []string {
+	if policy == nil {
+		return nil
+	}
+	paths := policy.Components[object.GetName()]
+	if policy.AllowPathsAnnotation {
+		if annotated := annotationPaths(object); len(annotated) > 0 {
+			paths = annotated
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil
+	}
+	return append(append([]string{}, paths...), policy.SharedPaths...)
+}
+
+func annotationPaths(object *unstructured.Unstructured) []string {
+	var paths []string
+	for _, path := range strings.Split(object.GetAnnotations()[PathsAnnotation], ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
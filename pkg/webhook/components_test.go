@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestComponentPaths(t *testing.T) {
+	policy := config.Policy{
+		Components:  map[string][]string{"api": {"services/api/**"}},
+		SharedPaths: []string{"libs/**"},
+	}
+	allowing := policy
+	allowing.AllowPathsAnnotation = true
+
+	tests := []struct {
+		name       string
+		policy     *config.Policy
+		objectName string
+		annotation string
+		want       []string
+	}{
+		{name: "component", policy: &policy, objectName: "api", want: []string{"services/api/**", "libs/**"}},
+		{name: "not a component", policy: &policy, objectName: "web"},
+		{name: "annotation is not allowed", policy: &policy, objectName: "api", annotation: "nonexistent/**", want: []string{"services/api/**", "libs/**"}},
+		{name: "annotation of not a component is not allowed", policy: &policy, objectName: "web", annotation: "nonexistent/**"},
+		{name: "allowed annotation keeps shared paths", policy: &allowing, objectName: "web", annotation: "services/web/**, docs/web/**", want: []string{"services/web/**", "docs/web/**", "libs/**"}},
+		{name: "allowed empty annotation", policy: &allowing, objectName: "api", annotation: " , ", want: []string{"services/api/**", "libs/**"}},
+		{name: "no policy", objectName: "api", annotation: "nonexistent/**"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			object.SetName(tt.objectName)
+			if tt.annotation != "" {
+				object.SetAnnotations(map[string]string{PathsAnnotation: tt.annotation})
+			}
+			if got := ComponentPaths(tt.policy, object); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ComponentPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alex123012/gitdeps/pkg/gitlab"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CheckDependencies returns why upstream versions required by .gitdeps.yaml of the commit sha
+// are not running, empty string is returned if they are or the project has no manifest.
+// Every running workload of the upstream project must contain the required commit,
+// workloads are matched by annotations set by the mutating webhook.
+func CheckDependencies(ctx context.Context, k8sClient kubernetes.Interface, pipelineUrl, sha, namespace string) (string, error) {
+	host, projectPath, _, err := gitlab.ParsePipelineURL(pipelineUrl)
+	if err != nil {
+		return "", err
+	}
+	manifest, err := gitlab.GetDependencyManifest(host, projectPath, sha)
+	if err != nil || manifest == nil {
+		return "", err
+	}
+
+	workloads := make(map[string][]metav1.ObjectMeta)
+	for _, dependency := range manifest.Dependencies {
+		dependencyNamespace := dependency.Namespace
+		if dependencyNamespace == "" {
+			dependencyNamespace = namespace
+		}
+		required, err := gitlab.ResolveCommit(host, dependency.Project, dependency.Ref)
+		if err != nil {
+			return "", err
+		}
+
+		objects, listed := workloads[dependencyNamespace]
+		if !listed {
+			objects, err = ListWorkloads(ctx, k8sClient, dependencyNamespace)
+			if err != nil {
+				return "", err
+			}
+			workloads[dependencyNamespace] = objects
+		}
+		running := 0
+		for _, object := range objects {
+			annotations := object.Annotations
+			if annotations[ProjectAnnotation] != dependency.Project || annotations[TargetSHAAnnotation] == "" {
+				continue
+			}
+			running++
+			contains, err := gitlab.ContainsCommit(host, dependency.Project, annotations[TargetSHAAnnotation], required)
+			if err != nil {
+				return "", err
+			}
+			if !contains {
+				return fmt.Sprintf("%s/%s runs %s of %s which doesn't contain required %s",
+					object.Namespace, object.Name, annotations[TargetSHAAnnotation], dependency.Project, dependency.Ref), nil
+			}
+		}
+		if running == 0 {
+			return fmt.Sprintf("required %s of %s is not running in namespace %s", dependency.Ref, dependency.Project, dependencyNamespace), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+// DevWebhookConf returns config for the webhook server running outside of the cluster
+// at devURL. Webhooks use url clientConfig, certificates are generated locally
+// and are neither stored nor rotated.
+func DevWebhookConf(WebhookConf config.WebHookConf, devURL string) (config.WebHookConf, error) {
+	webhookURL, err := url.Parse(devURL)
+	if err != nil {
+		return WebhookConf, fmt.Errorf("not valid dev url %q: %w", devURL, err)
+	}
+	if webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		return WebhookConf, fmt.Errorf("dev url %q must be https url with host", devURL)
+	}
+
+	validatePath := ClientConfigPath(WebhookConf.Webhook.ClientConfig)
+	if WebhookConf.Webhook.ClientConfig.Service != nil && WebhookConf.Webhook.ClientConfig.Service.Path == nil {
+		validatePath = "/validate"
+	}
+	validateURL := urlWithPath(devURL, validatePath)
+
+	conf := WebhookConf
+	conf.Webhook = *WebhookConf.Webhook.DeepCopy()
+	conf.Webhook.ClientConfig.Service = nil
+	conf.Webhook.ClientConfig.URL = &validateURL
+	conf.Tls.Secret = config.SecretConf{}
+	conf.Tls.Rotation.Enabled = false
+	conf.Tls.CertManager.Enabled = false
+	return conf, nil
+}
+
+// ServerPort returns port the webhook server listens on
+// taken from the service or url clientConfig of the primary webhook
+func ServerPort(WebhookConf config.WebHookConf) (int, error) {
+	clientConfig := WebhookConf.Webhook.ClientConfig
+	switch {
+	case clientConfig.Service != nil && clientConfig.Service.Port != nil:
+		return int(*clientConfig.Service.Port), nil
+	case clientConfig.URL != nil:
+		webhookURL, err := url.Parse(*clientConfig.URL)
+		if err != nil {
+			return 0, err
+		}
+		if webhookURL.Port() != "" {
+			return strconv.Atoi(webhookURL.Port())
+		}
+	}
+	return 443, nil
+}
@@ -0,0 +1,309 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+const diffContext = 3
+
+// ServiceManifest returns Service that exposes the webhook server
+func ServiceManifest(WebhookConf config.WebHookConf) (*corev1.Service, error) {
+	service := WebhookConf.Webhook.ClientConfig.Service
+	if service == nil {
+		return nil, fmt.Errorf("webhook clientConfig has no service")
+	}
+	port := int32(443)
+	if service.Port != nil {
+		port = *service.Port
+	}
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      service.Name,
+			Namespace: service.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": service.Name},
+			Ports: []corev1.ServicePort{{
+				Port:       port,
+				TargetPort: intstr.FromInt(int(port)),
+			}},
+		},
+	}, nil
+}
+
+// RBACManifests returns ServiceAccount and roles required by the webhook server
+func RBACManifests(WebhookConf config.WebHookConf) ([]runtime.Object, error) {
+	service := WebhookConf.Webhook.ClientConfig.Service
+	if service == nil {
+		return nil, fmt.Errorf("webhook clientConfig has no service")
+	}
+	name, namespace := service.Name, service.Namespace
+	subjects := []rbacv1.Subject{{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      name,
+		Namespace: namespace,
+	}}
+	rbacType := func(kind string) metav1.TypeMeta {
+		return metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: kind}
+	}
+	automount := true
+
+	return []runtime.Object{
+		&corev1.ServiceAccount{
+			TypeMeta:                     metav1.TypeMeta{APIVersion: corev1.SchemeGroupVersion.String(), Kind: "ServiceAccount"},
+			ObjectMeta:                   metav1.ObjectMeta{Name: name, Namespace: namespace},
+			AutomountServiceAccountToken: &automount,
+		},
+		&rbacv1.ClusterRole{
+			TypeMeta:   rbacType("ClusterRole"),
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Rules: []rbacv1.PolicyRule{{
+				APIGroups: []string{admissionregistrationv1.GroupName},
+				Resources: []string{"validatingwebhookconfigurations", "mutatingwebhookconfigurations"},
+				Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+			}, {
+				APIGroups: []string{appsv1.GroupName},
+				Resources: []string{"deployments", "statefulsets", "daemonsets"},
+				Verbs:     []string{"list"},
+			}},
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   rbacType("ClusterRoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Subjects:   subjects,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+		},
+		&rbacv1.Role{
+			TypeMeta:   rbacType("Role"),
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Rules: []rbacv1.PolicyRule{{
+				APIGroups: []string{corev1.GroupName},
+				Resources: []string{"secrets"},
+				Verbs:     []string{"get", "create", "update"},
+			}, {
+				APIGroups: []string{coordinationv1.GroupName},
+				Resources: []string{"leases"},
+				Verbs:     []string{"get", "list", "create", "update", "delete"},
+			}},
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta:   rbacType("RoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Subjects:   subjects,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+		},
+	}, nil
+}
+
+// PrintManifests writes objects as yaml documents or as json List
+func PrintManifests(w io.Writer, objects []runtime.Object, format string) error {
+	switch format {
+	case "yaml":
+		for _, object := range objects {
+			res, err := yaml.Marshal(object)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "---\n%s", res); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		var res []byte
+		var err error
+		if len(objects) == 1 {
+			res, err = json.MarshalIndent(objects[0], "", "  ")
+		} else {
+			list := &corev1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+			for _, object := range objects {
+				list.Items = append(list.Items, runtime.RawExtension{Object: object})
+			}
+			res, err = json.MarshalIndent(list, "", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(res))
+		return err
+	}
+	return fmt.Errorf("not valid output format %q, use one of [yaml, json]", format)
+}
+
+// DiffManifests returns line diff between yaml representations of the live and desired objects,
+// fields set by the apiserver are ignored. Empty string is returned if there are no differences.
+func DiffManifests(name string, live, desired runtime.Object) (string, error) {
+	liveYaml, err := manifestYaml(live)
+	if err != nil {
+		return "", err
+	}
+	desiredYaml, err := manifestYaml(desired)
+	if err != nil {
+		return "", err
+	}
+	if liveYaml == desiredYaml {
+		return "", nil
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s (live)\n+++ %s (desired)\n", name, name)
+	writeLineDiff(&out, strings.Split(liveYaml, "\n"), strings.Split(desiredYaml, "\n"))
+	return out.String(), nil
+}
+
+// SetServerDefaults sets defaults the apiserver fills in for omitted fields
+// of the webhook configuration webhooks, so the desired object can be compared with the live one
+func SetServerDefaults(object *unstructured.Unstructured) error {
+	webhookDefaults := map[string]interface{}{
+		"failurePolicy":     string(admissionregistrationv1.Fail),
+		"matchPolicy":       string(admissionregistrationv1.Equivalent),
+		"namespaceSelector": map[string]interface{}{},
+		"objectSelector":    map[string]interface{}{},
+		"timeoutSeconds":    int64(10),
+	}
+	if object.GetKind() == "MutatingWebhookConfiguration" {
+		webhookDefaults["reinvocationPolicy"] = string(admissionregistrationv1.NeverReinvocationPolicy)
+	}
+
+	webhooks, _, err := unstructured.NestedSlice(object.Object, "webhooks")
+	if err != nil {
+		return err
+	}
+	for _, item := range webhooks {
+		webhook, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for field, value := range webhookDefaults {
+			if _, found := webhook[field]; !found {
+				webhook[field] = value
+			}
+		}
+		if service, ok, _ := unstructured.NestedMap(webhook, "clientConfig", "service"); ok {
+			if _, found := service["port"]; !found {
+				if err := unstructured.SetNestedField(webhook, int64(443), "clientConfig", "service", "port"); err != nil {
+					return err
+				}
+			}
+		}
+		rules, _ := webhook["rules"].([]interface{})
+		for _, item := range rules {
+			if rule, ok := item.(map[string]interface{}); ok {
+				if _, found := rule["scope"]; !found {
+					rule["scope"] = string(admissionregistrationv1.AllScopes)
+				}
+			}
+		}
+	}
+	return unstructured.SetNestedSlice(object.Object, webhooks, "webhooks")
+}
+
+func manifestYaml(object runtime.Object) (string, error) {
+	if object == nil {
+		return "", nil
+	}
+	object = object.DeepCopyObject()
+	if accessor, ok := object.(metav1.Object); ok {
+		accessor.SetManagedFields(nil)
+		accessor.SetResourceVersion("")
+		accessor.SetUID("")
+		accessor.SetGeneration(0)
+		accessor.SetSelfLink("")
+		accessor.SetCreationTimestamp(metav1.Time{})
+	}
+	res, err := yaml.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	return string(res), nil
+}
+
+// writeLineDiff writes changed lines with some context around them
+func writeLineDiff(w io.Writer, a, b []string) {
+	// longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, line{'+', b[j]})
+			j++
+		default:
+			lines = append(lines, line{'-', a[i]})
+			i++
+		}
+	}
+
+	lastPrinted := -1
+	for k, l := range lines {
+		if l.op == ' ' || k <= lastPrinted {
+			continue
+		}
+		start := k - diffContext
+		if start <= lastPrinted {
+			start = lastPrinted + 1
+		}
+		if start < 0 {
+			start = 0
+		}
+		if lastPrinted < 0 || start > lastPrinted+1 {
+			fmt.Fprintln(w, "@@")
+		}
+		end := k + diffContext
+		for next := k + 1; next < len(lines) && next <= end; next++ {
+			if lines[next].op != ' ' {
+				end = next + diffContext
+			}
+		}
+		if end >= len(lines) {
+			end = len(lines) - 1
+		}
+		for p := start; p <= end; p++ {
+			fmt.Fprintf(w, "%c%s\n", lines[p].op, lines[p].text)
+		}
+		lastPrinted = end
+	}
+}
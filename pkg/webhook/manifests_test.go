@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	v1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// applied returns the object as the apiserver stores and returns it:
+// with defaulted webhook fields and server metadata
+func applied(t *testing.T, object runtime.Object) *unstructured.Unstructured {
+	t.Helper()
+	object = object.DeepCopyObject()
+	defaultRules := func(rules []v1.RuleWithOperations) {
+		for i := range rules {
+			if rules[i].Scope == nil {
+				scope := v1.AllScopes
+				rules[i].Scope = &scope
+			}
+		}
+	}
+	defaultClientConfig := func(clientConfig *v1.WebhookClientConfig) {
+		if clientConfig.Service != nil && clientConfig.Service.Port == nil {
+			port := int32(443)
+			clientConfig.Service.Port = &port
+		}
+	}
+	fail, equivalent, never, timeout := v1.Fail, v1.Equivalent, v1.NeverReinvocationPolicy, int32(10)
+
+	switch o := object.(type) {
+	case *v1.ValidatingWebhookConfiguration:
+		for i := range o.Webhooks {
+			w := &o.Webhooks[i]
+			if w.FailurePolicy == nil {
+				w.FailurePolicy = &fail
+			}
+			if w.MatchPolicy == nil {
+				w.MatchPolicy = &equivalent
+			}
+			if w.NamespaceSelector == nil {
+				w.NamespaceSelector = &metav1.LabelSelector{}
+			}
+			if w.ObjectSelector == nil {
+				w.ObjectSelector = &metav1.LabelSelector{}
+			}
+			if w.TimeoutSeconds == nil {
+				w.TimeoutSeconds = &timeout
+			}
+			defaultRules(w.Rules)
+			defaultClientConfig(&w.ClientConfig)
+		}
+	case *v1.MutatingWebhookConfiguration:
+		for i := range o.Webhooks {
+			w := &o.Webhooks[i]
+			if w.FailurePolicy == nil {
+				w.FailurePolicy = &fail
+			}
+			if w.MatchPolicy == nil {
+				w.MatchPolicy = &equivalent
+			}
+			if w.NamespaceSelector == nil {
+				w.NamespaceSelector = &metav1.LabelSelector{}
+			}
+			if w.ObjectSelector == nil {
+				w.ObjectSelector = &metav1.LabelSelector{}
+			}
+			if w.TimeoutSeconds == nil {
+				w.TimeoutSeconds = &timeout
+			}
+			if w.ReinvocationPolicy == nil {
+				w.ReinvocationPolicy = &never
+			}
+			defaultRules(w.Rules)
+			defaultClientConfig(&w.ClientConfig)
+		}
+	}
+
+	accessor := object.(metav1.Object)
+	accessor.SetUID("0b9e5f4c-2a51-4a5f-9a8e-1a2b3c4d5e6f")
+	accessor.SetResourceVersion("12345")
+	accessor.SetGeneration(1)
+	accessor.SetCreationTimestamp(metav1.Now())
+	accessor.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: FieldManager, Operation: metav1.ManagedFieldsOperationApply}})
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := &unstructured.Unstructured{}
+	if err := live.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	return live
+}
+
+func desiredObject(t *testing.T, object runtime.Object) *unstructured.Unstructured {
+	t.Helper()
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := &unstructured.Unstructured{Object: content}
+	if err := SetServerDefaults(desired); err != nil {
+		t.Fatal(err)
+	}
+	return desired
+}
+
+func TestDiffManifestsServerDefaults(t *testing.T) {
+	url := "https://gitdeps.example.com/validate"
+	serviceConf := config.WebHookConf{
+		Webhook: v1.ValidatingWebhook{
+			Name: "gitdeps.example.com",
+			ClientConfig: v1.WebhookClientConfig{
+				Service: &v1.ServiceReference{Name: "gitdeps", Namespace: "gitdeps"},
+			},
+			Rules: []v1.RuleWithOperations{{
+				Operations: []v1.OperationType{v1.Create, v1.Update},
+				Rule:       v1.Rule{APIGroups: []string{"apps"}, APIVersions: []string{"v1"}, Resources: []string{"deployments"}},
+			}},
+			AdmissionReviewVersions: []string{"v1"},
+		},
+	}
+	serviceConf.Metadata.Name = "gitdeps"
+	serviceConf.Mutating.Enabled = true
+	urlConf := serviceConf
+	urlConf.Webhook.ClientConfig = v1.WebhookClientConfig{URL: &url}
+	caBundle := bytes.NewBufferString("ca")
+
+	tests := []struct {
+		name     string
+		object   runtime.Object
+		modify   func(live *unstructured.Unstructured)
+		wantDiff bool
+	}{
+		{name: "validating service", object: ValidatingWebhookConfiguration(caBundle, serviceConf)},
+		{name: "validating url", object: ValidatingWebhookConfiguration(caBundle, urlConf)},
+		{name: "mutating", object: MutatingWebhookConfiguration(caBundle, serviceConf)},
+		{
+			name:   "changed timeout",
+			object: ValidatingWebhookConfiguration(caBundle, serviceConf),
+			modify: func(live *unstructured.Unstructured) {
+				webhooks, _, _ := unstructured.NestedSlice(live.Object, "webhooks")
+				webhooks[0].(map[string]interface{})["timeoutSeconds"] = int64(5)
+				_ = unstructured.SetNestedSlice(live.Object, webhooks, "webhooks")
+			},
+			wantDiff: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := applied(t, tt.object)
+			if tt.modify != nil {
+				tt.modify(live)
+			}
+			diff, err := DiffManifests("object", live, desiredObject(t, tt.object))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (diff != "") != tt.wantDiff {
+				t.Errorf("diff = %q, want diff %v", diff, tt.wantDiff)
+			}
+			if tt.wantDiff && !strings.Contains(diff, "timeoutSeconds") {
+				t.Errorf("diff doesn't show timeoutSeconds: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/hashicorp/go-hclog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// FieldManager is the server-side apply field manager of the webhook configurations
+	FieldManager = config.ApplicationName
+
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	InstanceLabel  = "gitdeps.io/instance"
+)
+
+// OwnershipLabels returns labels that mark webhook configurations
+// as managed by this gitdeps instance
+func OwnershipLabels(WebhookConf config.WebHookConf) map[string]string {
+	instance := WebhookConf.Metadata.Name
+	if service := WebhookConf.Webhook.ClientConfig.Service; service != nil {
+		instance = fmt.Sprintf("%s.%s", service.Name, service.Namespace)
+	}
+	return map[string]string{
+		ManagedByLabel: config.ApplicationName,
+		InstanceLabel:  instance,
+	}
+}
+
+// IsOwned reports whether object metadata carries ownership labels of this gitdeps instance
+func IsOwned(meta metav1.ObjectMeta, WebhookConf config.WebHookConf) bool {
+	for key, value := range OwnershipLabels(WebhookConf) {
+		if meta.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteWebhookConf deletes the validating webhook configuration from config.
+// Configurations not owned by this gitdeps instance are deleted only if force is set.
+// Deletion is preconditioned on the UID and resourceVersion that were checked.
+func DeleteWebhookConf(ctx context.Context, config *rest.Config, WebhookConf config.WebHookConf, force bool) error {
+	api, err := AdmissionApiFromConfig(config)
+	if err != nil {
+		return err
+	}
+	result, err := api.Get(ctx, WebhookConf.Metadata.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err := checkOwnership("ValidatingWebhookConfiguration", result.ObjectMeta, WebhookConf, force); err != nil {
+		return err
+	}
+	hclog.L().Info("Deleting ValidatingWebhookConfiguration", "name", result.Name)
+	return api.Delete(ctx, result.Name, preconditionedDelete(result.ObjectMeta))
+}
+
+// DeleteMutatingWebhookConf deletes the mutating webhook configuration from config,
+// ownership is checked the same way as in DeleteWebhookConf
+func DeleteMutatingWebhookConf(ctx context.Context, config *rest.Config, WebhookConf config.WebHookConf, force bool) error {
+	api, err := MutatingAdmissionApiFromConfig(config)
+	if err != nil {
+		return err
+	}
+	result, err := api.Get(ctx, WebhookConf.Metadata.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if err := checkOwnership("MutatingWebhookConfiguration", result.ObjectMeta, WebhookConf, force); err != nil {
+		return err
+	}
+	hclog.L().Info("Deleting MutatingWebhookConfiguration", "name", result.Name)
+	return api.Delete(ctx, result.Name, preconditionedDelete(result.ObjectMeta))
+}
+
+func checkOwnership(kind string, meta metav1.ObjectMeta, WebhookConf config.WebHookConf, force bool) error {
+	if IsOwned(meta, WebhookConf) {
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("%s %q is not managed by this %s instance, use --force to delete it anyway", kind, meta.Name, config.ApplicationName)
+	}
+	hclog.L().Warn(fmt.Sprintf("%s %q is not managed by this %s instance, deleting because of --force", kind, meta.Name, config.ApplicationName))
+	return nil
+}
+
+func preconditionedDelete(meta metav1.ObjectMeta) metav1.DeleteOptions {
+	return metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{
+			UID:             &meta.UID,
+			ResourceVersion: &meta.ResourceVersion,
+		},
+	}
+}
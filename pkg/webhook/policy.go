@@ -0,0 +1,239 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/hashicorp/go-hclog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	SelectAll        = "all"
+	SelectLabel      = "label"
+	SelectAnnotation = "annotation"
+
+	// EnforceLabel marks objects selected by policies with label selection
+	EnforceLabel = "gitdeps.io/enforce"
+
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+// ExcludedNamespaces returns namespaces that are never sent to the webhooks
+func ExcludedNamespaces(WebhookConf config.WebHookConf) []string {
+	namespaces := []string{"kube-system"}
+	if service := WebhookConf.Webhook.ClientConfig.Service; service != nil && service.Namespace != "" {
+		namespaces = append(namespaces, service.Namespace)
+	}
+	for _, namespace := range WebhookConf.ExcludedNamespaces {
+		if !contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// BoundPolicies returns policies bound to the webhook with the given name
+func BoundPolicies(WebhookConf config.WebHookConf, webhookName string) []config.Policy {
+	var policies []config.Policy
+	for _, policy := range WebhookConf.Policies {
+		if len(policy.Webhooks) == 0 || contains(policy.Webhooks, webhookName) {
+			policies = append(policies, policy)
+		}
+	}
+	return policies
+}
+
+// PolicySelectors returns namespaceSelector and objectSelector for the webhook
+// derived from the policies bound to it
+func PolicySelectors(WebhookConf config.WebHookConf, webhookName string) (*metav1.LabelSelector, *metav1.LabelSelector) {
+	return policySelectors(WebhookConf, BoundPolicies(WebhookConf, webhookName))
+}
+
+func policySelectors(WebhookConf config.WebHookConf, policies []config.Policy) (*metav1.LabelSelector, *metav1.LabelSelector) {
+	namespaceSelector := &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      namespaceNameLabel,
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   ExcludedNamespaces(WebhookConf),
+		}},
+	}
+
+	if len(policies) == 0 {
+		return namespaceSelector, nil
+	}
+
+	var namespaces []string
+	allNamespaces := false
+	for _, policy := range policies {
+		if len(policy.Namespaces) == 0 {
+			allNamespaces = true
+			break
+		}
+		for _, namespace := range policy.Namespaces {
+			if !contains(namespaces, namespace) {
+				namespaces = append(namespaces, namespace)
+			}
+		}
+	}
+	if !allNamespaces {
+		namespaceSelector.MatchExpressions = append(namespaceSelector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      namespaceNameLabel,
+			Operator: metav1.LabelSelectorOpIn,
+			Values:   namespaces,
+		})
+	}
+
+	if policiesSelect(policies, SelectLabel) {
+		return namespaceSelector, &metav1.LabelSelector{
+			MatchLabels: map[string]string{EnforceLabel: "true"},
+		}
+	}
+	return namespaceSelector, nil
+}
+
+// PolicyMatchConditions returns CEL matchConditions for the webhook
+// derived from the policies bound to it
+func PolicyMatchConditions(WebhookConf config.WebHookConf, webhookName string) []interface{} {
+	policies := BoundPolicies(WebhookConf, webhookName)
+	if len(policies) == 0 || !policiesSelect(policies, SelectAnnotation) {
+		return nil
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"name": "pipeline-annotation",
+			"expression": fmt.Sprintf(
+				"request.operation == 'DELETE' || (has(object.metadata.annotations) && '%s' in object.metadata.annotations)",
+				PipelineURLAnnotation,
+			),
+		},
+	}
+}
+
+// WithMatchConditions returns webhook configuration as unstructured object
+// with matchConditions from policies set on every webhook. Typed webhook
+// configurations of the used client-go version have no matchConditions field.
+func WithMatchConditions(object runtime.Object, WebhookConf config.WebHookConf) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, _, err := unstructured.NestedSlice(content, "webhooks")
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhook, ok := webhooks[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(webhook, "name")
+		if conditions := PolicyMatchConditions(WebhookConf, name); len(conditions) > 0 {
+			webhook["matchConditions"] = conditions
+		}
+	}
+	if err := unstructured.SetNestedSlice(content, webhooks, "webhooks"); err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// MatchConditionsEnabled reports whether matchConditions should be generated.
+// In auto mode the cluster version is checked, matchConditions are
+// enabled by default since Kubernetes 1.28
+func MatchConditionsEnabled(restConfig *rest.Config, WebhookConf config.WebHookConf) (bool, error) {
+	switch strings.ToLower(WebhookConf.MatchConditions) {
+	case "true":
+		return true, nil
+	case "", "false":
+		return false, nil
+	case "auto":
+	default:
+		return false, fmt.Errorf("not valid match_conditions %q, use one of [auto, true, false]", WebhookConf.MatchConditions)
+	}
+
+	if restConfig == nil {
+		hclog.L().Debug("Cluster is not available, matchConditions are not generated")
+		return false, nil
+	}
+	client, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return false, err
+	}
+	version, err := client.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	major, err := strconv.Atoi(strings.TrimRight(version.Major, "+"))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse server major version %q: %w", version.Major, err)
+	}
+	minor, err := strconv.Atoi(strings.TrimRight(version.Minor, "+"))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse server minor version %q: %w", version.Minor, err)
+	}
+	return major > 1 || (major == 1 && minor >= 28), nil
+}
+
+// MatchingPolicy returns the first policy bound to one of the webhooks that enforces the namespace.
+// ok is false if policies are configured and none of them enforces the namespace
+func MatchingPolicy(WebhookConf config.WebHookConf, webhookNames []string, namespace string) (*config.Policy, bool) {
+	if len(WebhookConf.Policies) == 0 {
+		return nil, true
+	}
+	if namespace != "" && contains(ExcludedNamespaces(WebhookConf), namespace) {
+		return nil, false
+	}
+	for i, policy := range WebhookConf.Policies {
+		bound := len(policy.Webhooks) == 0 || len(webhookNames) == 0
+		for _, name := range webhookNames {
+			bound = bound || contains(policy.Webhooks, name)
+		}
+		if !bound {
+			continue
+		}
+		if len(policy.Namespaces) == 0 || namespace == "" || contains(policy.Namespaces, namespace) {
+			return &WebhookConf.Policies[i], true
+		}
+	}
+	return nil, false
+}
+
+// PolicySelects reports whether the policy selects the object with given labels and annotations
+func PolicySelects(policy *config.Policy, labels, annotations map[string]string) bool {
+	if policy == nil {
+		return true
+	}
+	switch policy.Selection {
+	case SelectLabel:
+		return labels[EnforceLabel] == "true"
+	case SelectAnnotation:
+		_, ok := annotations[PipelineURLAnnotation]
+		return ok
+	}
+	return true
+}
+
+func policiesSelect(policies []config.Policy, selection string) bool {
+	for _, policy := range policies {
+		if policy.Selection != selection {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
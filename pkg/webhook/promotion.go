@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	PromotionGitLab  = "gitlab"
+	PromotionCluster = "cluster"
+)
+
+// ClusterLookupEnabled reports whether any policy looks up workloads in the cluster
+func ClusterLookupEnabled(WebhookConf config.WebHookConf) bool {
+	for _, policy := range WebhookConf.Policies {
+		if policy.Promotion.Source == PromotionCluster || policy.CheckDependencies {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckClusterLookup returns error if policies look up workloads by annotations
+// that are set only by the mutating webhook while it is disabled
+func CheckClusterLookup(WebhookConf config.WebHookConf) error {
+	if WebhookConf.Mutating.Enabled {
+		return nil
+	}
+	for _, policy := range WebhookConf.Policies {
+		if policy.Promotion.Source == PromotionCluster {
+			return fmt.Errorf("promotion source %q of policy %q requires mutating webhook, set mutating.enabled", PromotionCluster, policy.Name)
+		}
+		if policy.CheckDependencies {
+			return fmt.Errorf("check_dependencies of policy %q requires mutating webhook, set mutating.enabled", policy.Name)
+		}
+	}
+	return nil
+}
+
+// CheckClusterPromotion returns why the commit sha of the project is not promoted
+// from the promotion namespace, empty string is returned if a workload there runs it
+// for at least the soak time. Workloads are matched by annotations set by the mutating webhook.
+func CheckClusterPromotion(ctx context.Context, k8sClient kubernetes.Interface, promotion config.PromotionConf, project, sha string, now time.Time) (string, error) {
+	objects, err := ListWorkloads(ctx, k8sClient, promotion.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	var deployedAt *time.Time
+	for _, object := range objects {
+		annotations := object.Annotations
+		if annotations[ProjectAnnotation] != project || annotations[TargetSHAAnnotation] != sha {
+			continue
+		}
+		verifiedAt, err := time.Parse(time.RFC3339, annotations[VerifiedAtAnnotation])
+		if err != nil {
+			verifiedAt = now
+		}
+		if deployedAt == nil || verifiedAt.Before(*deployedAt) {
+			deployedAt = &verifiedAt
+		}
+	}
+
+	if deployedAt == nil {
+		return fmt.Sprintf("commit %s of %s is not running in namespace %s", sha, project, promotion.Namespace), nil
+	}
+	if now.Sub(*deployedAt) < promotion.Soak {
+		return fmt.Sprintf("commit %s is running in namespace %s for %s, minimal soak time is %s",
+			sha, promotion.Namespace, now.Sub(*deployedAt).Round(time.Second), promotion.Soak), nil
+	}
+	return "", nil
+}
+
+// ListWorkloads returns metadata of Deployments, StatefulSets and DaemonSets in the namespace,
+// every namespace is listed if it is empty
+func ListWorkloads(ctx context.Context, k8sClient kubernetes.Interface, namespace string) ([]metav1.ObjectMeta, error) {
+	if k8sClient == nil {
+		return nil, fmt.Errorf("workloads lookup requires kubernetes client")
+	}
+
+	apps := k8sClient.AppsV1()
+	var objects []metav1.ObjectMeta
+	deployments, err := apps.Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range deployments.Items {
+		objects = append(objects, object.ObjectMeta)
+	}
+	statefulSets, err := apps.StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range statefulSets.Items {
+		objects = append(objects, object.ObjectMeta)
+	}
+	daemonSets, err := apps.DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range daemonSets.Items {
+		objects = append(objects, object.ObjectMeta)
+	}
+	return objects, nil
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckClusterPromotion(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	staging := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:      "app",
+		Namespace: "staging",
+		Annotations: map[string]string{
+			ProjectAnnotation:    "group/app",
+			TargetSHAAnnotation:  "abc",
+			VerifiedAtAnnotation: now.Add(-2 * time.Hour).Format(time.RFC3339),
+		},
+	}}
+	tests := []struct {
+		name string
+		sha  string
+		soak time.Duration
+		want string
+	}{
+		{name: "soaked", sha: "abc", soak: time.Hour},
+		{name: "not soaked", sha: "abc", soak: 3 * time.Hour, want: "commit abc is running in namespace staging for 2h0m0s, minimal soak time is 3h0m0s"},
+		{name: "not running", sha: "def", want: "commit def of group/app is not running in namespace staging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(staging)
+			promotion := config.PromotionConf{Source: PromotionCluster, Namespace: "staging", Soak: tt.soak}
+			got, err := CheckClusterPromotion(context.Background(), client, promotion, "group/app", tt.sha, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CheckClusterPromotion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckClusterLookup(t *testing.T) {
+	conf := config.WebHookConf{Policies: []config.Policy{{Name: "production", Promotion: config.PromotionConf{Source: PromotionCluster}}}}
+	if err := CheckClusterLookup(conf); err == nil {
+		t.Error("expected error with disabled mutating webhook")
+	}
+	conf.Mutating.Enabled = true
+	if err := CheckClusterLookup(conf); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
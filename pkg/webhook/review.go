@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DeniedReason and DeniedCode are set in results of denied requests,
+// the apiserver keeps them in the error returned to the client
+const (
+	DeniedReason = metav1.StatusReasonConflict
+	DeniedCode   = http.StatusConflict
+)
+
+var (
+	admissionReviewV1      = admissionv1.SchemeGroupVersion.WithKind("AdmissionReview")
+	admissionReviewV1beta1 = admissionv1beta1.SchemeGroupVersion.WithKind("AdmissionReview")
+)
+
+// DecodeAdmissionReview decodes v1 or v1beta1 AdmissionReview. v1beta1 reviews are converted to v1
+// keeping the v1beta1 apiVersion, so the response is encoded in the version of the request
+func DecodeAdmissionReview(body []byte, deserializer runtime.Decoder) (*admissionv1.AdmissionReview, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(body, &typeMeta); err != nil {
+		return nil, err
+	}
+
+	switch typeMeta.GroupVersionKind() {
+	case admissionReviewV1:
+		review := &admissionv1.AdmissionReview{}
+		if _, _, err := deserializer.Decode(body, nil, review); err != nil {
+			return nil, err
+		}
+		return review, nil
+	case admissionReviewV1beta1:
+		v1beta1Review := &admissionv1beta1.AdmissionReview{}
+		if _, _, err := deserializer.Decode(body, nil, v1beta1Review); err != nil {
+			return nil, err
+		}
+		review := &admissionv1.AdmissionReview{}
+		review.SetGroupVersionKind(admissionReviewV1beta1)
+		if v1beta1Review.Request != nil {
+			review.Request = v1Request(v1beta1Review.Request)
+		}
+		return review, nil
+	}
+	return nil, fmt.Errorf("unsupported %s %q, expected one of [%s, %s]", typeMeta.Kind, typeMeta.APIVersion,
+		admissionReviewV1.GroupVersion(), admissionReviewV1beta1.GroupVersion())
+}
+
+// AdmissionReviewResponse returns AdmissionReview of the given version with the response
+func AdmissionReviewResponse(gvk schema.GroupVersionKind, response *admissionv1.AdmissionResponse) (runtime.Object, error) {
+	switch gvk {
+	case admissionReviewV1:
+		review := &admissionv1.AdmissionReview{Response: response}
+		review.SetGroupVersionKind(gvk)
+		return review, nil
+	case admissionReviewV1beta1:
+		review := &admissionv1beta1.AdmissionReview{Response: v1beta1Response(response)}
+		review.SetGroupVersionKind(gvk)
+		return review, nil
+	}
+	return nil, fmt.Errorf("unsupported %s %q", gvk.Kind, gvk.GroupVersion())
+}
+
+func v1Request(request *admissionv1beta1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:                request.UID,
+		Kind:               request.Kind,
+		Resource:           request.Resource,
+		SubResource:        request.SubResource,
+		RequestKind:        request.RequestKind,
+		RequestResource:    request.RequestResource,
+		RequestSubResource: request.RequestSubResource,
+		Name:               request.Name,
+		Namespace:          request.Namespace,
+		Operation:          admissionv1.Operation(request.Operation),
+		UserInfo:           request.UserInfo,
+		Object:             request.Object,
+		OldObject:          request.OldObject,
+		DryRun:             request.DryRun,
+		Options:            request.Options,
+	}
+}
+
+func v1beta1Response(response *admissionv1.AdmissionResponse) *admissionv1beta1.AdmissionResponse {
+	if response == nil {
+		return nil
+	}
+	converted := &admissionv1beta1.AdmissionResponse{
+		UID:              response.UID,
+		Allowed:          response.Allowed,
+		Result:           response.Result,
+		Patch:            response.Patch,
+		AuditAnnotations: response.AuditAnnotations,
+		Warnings:         response.Warnings,
+	}
+	if response.PatchType != nil {
+		patchType := admissionv1beta1.PatchType(*response.PatchType)
+		converted.PatchType = &patchType
+	}
+	return converted
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+func TestAdmissionReviewRoundTrip(t *testing.T) {
+	deserializer := serializer.NewCodecFactory(runtime.NewScheme()).UniversalDeserializer()
+	tests := []struct {
+		name       string
+		apiVersion string
+	}{
+		{name: "v1", apiVersion: "admission.k8s.io/v1"},
+		{name: "v1beta1", apiVersion: "admission.k8s.io/v1beta1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{
+				"apiVersion": "` + tt.apiVersion + `",
+				"kind": "AdmissionReview",
+				"request": {
+					"uid": "705ab4f5-6393-11e8-b7cc-42010a800002",
+					"kind": {"group": "apps", "version": "v1", "kind": "Deployment"},
+					"resource": {"group": "apps", "version": "v1", "resource": "deployments"},
+					"name": "app",
+					"namespace": "default",
+					"operation": "UPDATE",
+					"userInfo": {"username": "admin"},
+					"object": {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "app"}}
+				}
+			}`)
+
+			review, err := DecodeAdmissionReview(body, deserializer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if review.Request == nil {
+				t.Fatal("request is not decoded")
+			}
+			if review.Request.Operation != admissionv1.Update || review.Request.Namespace != "default" {
+				t.Errorf("request = %+v, fields are not decoded", review.Request)
+			}
+
+			patchType := admissionv1.PatchTypeJSONPatch
+			response, err := AdmissionReviewResponse(review.GroupVersionKind(), &admissionv1.AdmissionResponse{
+				UID:       review.Request.UID,
+				Allowed:   true,
+				Patch:     []byte(`[]`),
+				PatchType: &patchType,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(response)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+				Response   struct {
+					UID       string `json:"uid"`
+					Allowed   bool   `json:"allowed"`
+					PatchType string `json:"patchType"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.APIVersion != tt.apiVersion || got.Kind != "AdmissionReview" {
+				t.Errorf("response is %s %s, want %s AdmissionReview", got.APIVersion, got.Kind, tt.apiVersion)
+			}
+			if got.Response.UID != "705ab4f5-6393-11e8-b7cc-42010a800002" || !got.Response.Allowed {
+				t.Errorf("response = %+v, want allowed with request uid", got.Response)
+			}
+			if got.Response.PatchType != "JSONPatch" {
+				t.Errorf("patchType = %q, want JSONPatch", got.Response.PatchType)
+			}
+		})
+	}
+}
+
+func TestDecodeAdmissionReviewUnsupported(t *testing.T) {
+	deserializer := serializer.NewCodecFactory(runtime.NewScheme()).UniversalDeserializer()
+	_, err := DecodeAdmissionReview([]byte(`{"apiVersion": "admission.k8s.io/v2", "kind": "AdmissionReview"}`), deserializer)
+	if err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"github.com/alex123012/gitdeps/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	RollbackDeny = "deny"
+	RollbackWarn = "warn"
+)
+
+// RollbackAction returns what the policy does with rollbacks, deny by default
+func RollbackAction(policy *config.Policy) string {
+	if policy != nil && policy.Rollback == RollbackWarn {
+		return RollbackWarn
+	}
+	return RollbackDeny
+}
+
+// DeployedPipelineURL returns the pipeline url of the old object if the update changes it,
+// empty string is returned if there is nothing to compare with
+func DeployedPipelineURL(oldObject, object *unstructured.Unstructured) string {
+	if oldObject == nil {
+		return ""
+	}
+	deployed := oldObject.GetAnnotations()[PipelineURLAnnotation]
+	if deployed == object.GetAnnotations()[PipelineURLAnnotation] {
+		return ""
+	}
+	return deployed
+}
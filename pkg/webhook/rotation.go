@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/hashicorp/go-hclog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// Keypair holds the serving certificate and allows to replace it
+// while the server is running
+type Keypair struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func NewKeypair(certPEM, keyPEM []byte) (*Keypair, error) {
+	keypair := &Keypair{}
+	if err := keypair.Update(certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	return keypair, nil
+}
+
+// Update replaces the served certificate
+func (k *Keypair) Update(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.cert = &cert
+	return nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (k *Keypair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.cert, nil
+}
+
+// CABundle returns PEM encoded CAs that the apiserver should trust
+func CABundle(certs map[string]*bytes.Buffer) *bytes.Buffer {
+	if bundle, ok := certs["ca-bundle"]; ok {
+		return bundle
+	}
+	return certs["ca"]
+}
+
+// RenewCertificate returns certificates with the CA and the serving certificate
+// renewed if they expire within the configured periods, and whether anything changed.
+// A rolled CA is appended to the CA bundle, the previous CA stays there until it expires,
+// so serving certificates signed by either CA are trusted during the overlap.
+func RenewCertificate(WebhookConf config.WebHookConf, certs map[string]*bytes.Buffer, now time.Time) (map[string]*bytes.Buffer, bool, error) {
+	rotation := WebhookConf.Tls.Rotation
+	caPEM, caPrivKeyPEM := certs["ca"], certs["ca-key"]
+	certPEM, keyPEM := certs["cert"], certs["key"]
+
+	ca, err := ParseCertificate(caPEM.Bytes())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	serverCert, err := ParseCertificate(certPEM.Bytes())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse server certificate: %w", err)
+	}
+	bundle, err := ParseCertificates(CABundle(certs).Bytes())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse CA bundle: %w", err)
+	}
+
+	bundleChanged := false
+	trusted := make([]*x509.Certificate, 0, len(bundle)+1)
+	for _, cert := range bundle {
+		if now.Before(cert.NotAfter) {
+			trusted = append(trusted, cert)
+		} else {
+			bundleChanged = true
+		}
+	}
+
+	caRolled := false
+	if now.Add(rotation.CARenewBefore).After(ca.NotAfter) {
+		hclog.L().Info("Rolling webhook CA", "expires", ca.NotAfter)
+		caPEM, caPrivKeyPEM, err = GenerateCA(WebhookConf)
+		if err != nil {
+			return nil, false, err
+		}
+		ca, err = ParseCertificate(caPEM.Bytes())
+		if err != nil {
+			return nil, false, err
+		}
+		caRolled = true
+	}
+
+	if !containsCertificate(trusted, ca) {
+		trusted = append(trusted, ca)
+		bundleChanged = true
+	}
+
+	if caRolled || now.Add(rotation.RenewBefore).After(serverCert.NotAfter) || serverCert.CheckSignatureFrom(ca) != nil {
+		hclog.L().Info("Renewing webhook serving certificate", "expires", serverCert.NotAfter)
+		certPEM, keyPEM, err = SignServerCertificate(WebhookConf, caPEM.Bytes(), caPrivKeyPEM.Bytes())
+		if err != nil {
+			return nil, false, err
+		}
+	} else if !bundleChanged {
+		return certs, false, nil
+	}
+
+	bundlePEM := new(bytes.Buffer)
+	for _, cert := range trusted {
+		encoded, err := encodePEM("CERTIFICATE", cert.Raw)
+		if err != nil {
+			return nil, false, err
+		}
+		bundlePEM.Write(encoded.Bytes())
+	}
+
+	return map[string]*bytes.Buffer{
+		"ca":        caPEM,
+		"ca-key":    caPrivKeyPEM,
+		"ca-bundle": bundlePEM,
+		"cert":      certPEM,
+		"key":       keyPEM,
+	}, true, nil
+}
+
+// CertificateRotator renews certificates of the running webhook server,
+// stores them in the certificates Secret and keeps caBundle
+// of the webhook configurations up to date
+type CertificateRotator struct {
+	conf       config.WebHookConf
+	restConfig *rest.Config
+	keypair    *Keypair
+	certs      map[string]*bytes.Buffer
+	// bundle is the caBundle last set in the webhook configurations
+	bundle []byte
+	// served is the serving certificate in use
+	served []byte
+}
+
+func NewCertificateRotator(restConfig *rest.Config, WebhookConf config.WebHookConf, certs map[string]*bytes.Buffer, keypair *Keypair) (*CertificateRotator, error) {
+	if !CertificateSecretEnabled(WebhookConf) {
+		return nil, fmt.Errorf("tls.rotation requires tls.secret, otherwise every replica rotates its own CA")
+	}
+	return &CertificateRotator{
+		conf:       WebhookConf,
+		restConfig: restConfig,
+		keypair:    keypair,
+		certs:      certs,
+		bundle:     CABundle(certs).Bytes(),
+		served:     certs["cert"].Bytes(),
+	}, nil
+}
+
+// Run checks certificates every check interval until ctx is done
+func (r *CertificateRotator) Run(ctx context.Context) {
+	interval := r.conf.Tls.Rotation.CheckInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Rotate(ctx); err != nil {
+			hclog.L().Error(fmt.Sprintf("certificate rotation failed: %v", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Rotate renews certificates if needed. Certificates are reloaded from the Secret first,
+// so replicas pick up renewals made by each other. caBundle is patched only if it changed,
+// and the renewed certificate is served only after the registered caBundle trusts it,
+// so after a CA roll the previous certificate is served until a later check.
+func (r *CertificateRotator) Rotate(ctx context.Context) error {
+	api, err := SecretApiFromConfig(r.restConfig, CertificateSecretNamespace(r.conf))
+	if err != nil {
+		return err
+	}
+	secret, err := api.Get(ctx, r.conf.Tls.Secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	certs, ok := CertificateFromSecret(secret)
+	if !ok {
+		return fmt.Errorf("certificates secret %q is incomplete", secret.Name)
+	}
+
+	rotated, changed, err := RenewCertificate(r.conf, certs, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if changed {
+		_, err = api.Update(ctx, UpdatedCertificateSecret(secret, r.conf, rotated), metav1.UpdateOptions{})
+		if errors.IsConflict(err) {
+			hclog.L().Debug("Certificates secret was changed by another replica, will reload on the next check")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.certs = rotated
+
+	if bundle := CABundle(rotated).Bytes(); !bytes.Equal(bundle, r.bundle) {
+		if err := PatchCABundle(ctx, r.restConfig, bundle, r.conf); err != nil {
+			return err
+		}
+		r.bundle = bundle
+		if !bytes.Equal(rotated["cert"].Bytes(), r.served) {
+			hclog.L().Info("Renewed webhook certificate will be served on the next check")
+		}
+		return nil
+	}
+
+	if bytes.Equal(rotated["cert"].Bytes(), r.served) {
+		return nil
+	}
+	bundles, err := LiveCABundles(ctx, r.restConfig, r.conf)
+	if err != nil {
+		return err
+	}
+	trusted, err := trustedByAll(bundles, rotated["cert"].Bytes())
+	if err != nil {
+		return err
+	}
+	if !trusted {
+		hclog.L().Info("Registered caBundle doesn't trust renewed webhook certificate yet")
+		return nil
+	}
+
+	hclog.L().Info("Serving renewed webhook certificate")
+	if err := r.keypair.Update(rotated["cert"].Bytes(), rotated["key"].Bytes()); err != nil {
+		return err
+	}
+	r.served = rotated["cert"].Bytes()
+	return nil
+}
+
+// trustedByAll reports whether the certificate is signed by a CA from every bundle
+func trustedByAll(bundles [][]byte, certPEM []byte) (bool, error) {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return false, err
+	}
+	for _, bundle := range bundles {
+		cas, err := ParseCertificates(bundle)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse registered caBundle: %w", err)
+		}
+		signed := false
+		for _, ca := range cas {
+			if cert.CheckSignatureFrom(ca) == nil {
+				signed = true
+				break
+			}
+		}
+		if !signed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
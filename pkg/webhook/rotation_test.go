@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+)
+
+func TestTrustedByAll(t *testing.T) {
+	conf := config.WebHookConf{}
+	conf.Tls.KeyType = "ecdsa"
+	conf.Tls.Validity = 24 * time.Hour
+
+	oldCA, oldKey, err := GenerateCA(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCA, newKey, err := GenerateCA(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCert, _, err := SignServerCertificate(conf, oldCA.Bytes(), oldKey.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert, _, err := SignServerCertificate(conf, newCA.Bytes(), newKey.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	both := append(append([]byte{}, oldCA.Bytes()...), newCA.Bytes()...)
+
+	tests := []struct {
+		name    string
+		bundles [][]byte
+		cert    *bytes.Buffer
+		want    bool
+	}{
+		{name: "no configurations", cert: newCert, want: true},
+		{name: "old bundle, old certificate", bundles: [][]byte{oldCA.Bytes()}, cert: oldCert, want: true},
+		{name: "old bundle, certificate of rolled CA", bundles: [][]byte{oldCA.Bytes()}, cert: newCert, want: false},
+		{name: "bundle with both CAs", bundles: [][]byte{both, both}, cert: newCert, want: true},
+		{name: "one webhook not patched yet", bundles: [][]byte{both, oldCA.Bytes()}, cert: newCert, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trustedByAll(tt.bundles, tt.cert.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("trustedByAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	"github.com/hashicorp/go-hclog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	coreTyped "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	SecretCACertKey   = "ca.crt"
+	SecretCAKeyKey    = "ca.key"
+	SecretCABundleKey = "ca-bundle.crt"
+
+	secretAttempts = 5
+)
+
+// secretKeys maps keys of the GenerateCertificate result to the Secret data keys
+var secretKeys = map[string]string{
+	"ca":     SecretCACertKey,
+	"ca-key": SecretCAKeyKey,
+	"cert":   corev1.TLSCertKey,
+	"key":    corev1.TLSPrivateKeyKey,
+}
+
+// CertificateSecretEnabled reports whether certificates should be kept in a Secret
+func CertificateSecretEnabled(WebhookConf config.WebHookConf) bool {
+	return WebhookConf.Tls.Secret.Name != ""
+}
+
+// CertificateSecretNamespace returns namespace of the certificates Secret
+func CertificateSecretNamespace(WebhookConf config.WebHookConf) string {
+	if WebhookConf.Tls.Secret.Namespace != "" {
+		return WebhookConf.Tls.Secret.Namespace
+	}
+	if service := WebhookConf.Webhook.ClientConfig.Service; service != nil {
+		return service.Namespace
+	}
+	return metav1.NamespaceDefault
+}
+
+// LoadOrCreateCertificate returns certificates stored in the Secret from config.
+// If the Secret doesn't exist or is incomplete, new certificates are generated and saved,
+// so every replica and restart reuses the same CA. Concurrent writers are resolved
+// by the apiserver: the loser of a create or update race reloads the winner's Secret.
+func LoadOrCreateCertificate(ctx context.Context, config *rest.Config, WebhookConf config.WebHookConf) (map[string]*bytes.Buffer, error) {
+	api, err := SecretApiFromConfig(config, CertificateSecretNamespace(WebhookConf))
+	if err != nil {
+		return nil, err
+	}
+	name := WebhookConf.Tls.Secret.Name
+
+	for attempt := 0; attempt < secretAttempts; attempt++ {
+		secret, err := api.Get(ctx, name, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		found := err == nil
+		if found {
+			if certs, ok := CertificateFromSecret(secret); ok {
+				hclog.L().Info("Using certificates from secret", "secret", name)
+				return certs, nil
+			}
+		}
+
+		certs, err := GenerateCertificate(WebhookConf, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			hclog.L().Info("Creating certificates secret", "secret", name)
+			_, err = api.Create(ctx, CertificateSecret(WebhookConf, certs), metav1.CreateOptions{})
+		} else {
+			hclog.L().Info("Updating incomplete certificates secret", "secret", name)
+			_, err = api.Update(ctx, UpdatedCertificateSecret(secret, WebhookConf, certs), metav1.UpdateOptions{})
+		}
+
+		if errors.IsAlreadyExists(err) || errors.IsConflict(err) {
+			hclog.L().Debug("Certificates secret was changed concurrently, reloading", "secret", name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return certs, nil
+	}
+	return nil, fmt.Errorf("failed to load or create certificates secret %q after %d attempts", name, secretAttempts)
+}
+
+// ReadCertificate returns certificates stored in the Secret from config
+// and whether the Secret exists and is complete. Nothing is written to the cluster.
+func ReadCertificate(ctx context.Context, config *rest.Config, WebhookConf config.WebHookConf) (map[string]*bytes.Buffer, bool, error) {
+	api, err := SecretApiFromConfig(config, CertificateSecretNamespace(WebhookConf))
+	if err != nil {
+		return nil, false, err
+	}
+	secret, err := api.Get(ctx, WebhookConf.Tls.Secret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	certs, ok := CertificateFromSecret(secret)
+	return certs, ok, nil
+}
+
+// CertificateSecret returns Secret with certificates for the webhook
+func CertificateSecret(WebhookConf config.WebHookConf, certs map[string]*bytes.Buffer) *corev1.Secret {
+	data := make(map[string][]byte, len(secretKeys))
+	for certKey, secretKey := range secretKeys {
+		if cert, ok := certs[certKey]; ok {
+			data[secretKey] = cert.Bytes()
+		}
+	}
+	if bundle, ok := certs["ca-bundle"]; ok {
+		data[SecretCABundleKey] = bundle.Bytes()
+	}
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      WebhookConf.Tls.Secret.Name,
+			Namespace: CertificateSecretNamespace(WebhookConf),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: data,
+	}
+}
+
+// UpdatedCertificateSecret returns copy of the existing Secret with certificates data.
+// Type of the Secret is immutable, so it is kept, as are keys not managed by gitdeps
+func UpdatedCertificateSecret(secret *corev1.Secret, WebhookConf config.WebHookConf, certs map[string]*bytes.Buffer) *corev1.Secret {
+	updated := secret.DeepCopy()
+	if updated.Data == nil {
+		updated.Data = map[string][]byte{}
+	}
+	for _, key := range secretKeys {
+		delete(updated.Data, key)
+	}
+	delete(updated.Data, SecretCABundleKey)
+	for key, value := range CertificateSecret(WebhookConf, certs).Data {
+		updated.Data[key] = value
+	}
+	return updated
+}
+
+// CertificateFromSecret returns certificates stored in the Secret
+// and whether all of them are present
+func CertificateFromSecret(secret *corev1.Secret) (map[string]*bytes.Buffer, bool) {
+	certs := make(map[string]*bytes.Buffer, len(secretKeys))
+	for certKey, secretKey := range secretKeys {
+		value, ok := secret.Data[secretKey]
+		if !ok || len(value) == 0 {
+			return nil, false
+		}
+		certs[certKey] = bytes.NewBuffer(value)
+	}
+	if bundle, ok := secret.Data[SecretCABundleKey]; ok && len(bundle) > 0 {
+		certs["ca-bundle"] = bytes.NewBuffer(bundle)
+	}
+	return certs, true
+}
+
+func SecretApiFromConfig(config *rest.Config, namespace string) (coreTyped.SecretInterface, error) {
+	k8sClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return k8sClient.CoreV1().Secrets(namespace), nil
+}
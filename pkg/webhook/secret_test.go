@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestUpdatedCertificateSecret(t *testing.T) {
+	certs := map[string]*bytes.Buffer{
+		"ca":     bytes.NewBufferString("ca"),
+		"ca-key": bytes.NewBufferString("ca-key"),
+		"cert":   bytes.NewBufferString("cert"),
+		"key":    bytes.NewBufferString("key"),
+	}
+	tests := []struct {
+		name     string
+		existing corev1.Secret
+	}{
+		{name: "opaque", existing: corev1.Secret{Type: corev1.SecretTypeOpaque, Data: map[string][]byte{"other": []byte("value")}}},
+		{name: "tls", existing: corev1.Secret{Type: corev1.SecretTypeTLS}},
+		{name: "empty type", existing: corev1.Secret{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := UpdatedCertificateSecret(&tt.existing, config.WebHookConf{}, certs)
+			if updated.Type != tt.existing.Type {
+				t.Errorf("type = %q, want %q", updated.Type, tt.existing.Type)
+			}
+			for key, value := range tt.existing.Data {
+				if !bytes.Equal(updated.Data[key], value) {
+					t.Errorf("data[%q] = %q, want %q", key, updated.Data[key], value)
+				}
+			}
+			if string(updated.Data[corev1.TLSCertKey]) != "cert" || string(updated.Data[SecretCACertKey]) != "ca" {
+				t.Errorf("certificates are not set: %v", updated.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const SelfTestName = "gitdeps-selftest"
+
+// SelfTestObject returns Deployment that is sent to the webhook by self test
+func SelfTestObject(namespace, pipelineURL string) *appsv1.Deployment {
+	labels := map[string]string{"app": SelfTestName, EnforceLabel: "true"}
+	deployment := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SelfTestName,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "pause", Image: "registry.k8s.io/pause:3.9"}},
+				},
+			},
+		},
+	}
+	if pipelineURL != "" {
+		deployment.Annotations = map[string]string{PipelineURLAnnotation: pipelineURL}
+	}
+	return deployment
+}
+
+// SelfTestReview returns AdmissionReview with dry run CREATE request of the object
+func SelfTestReview(object *appsv1.Deployment) (*admissionv1.AdmissionReview, error) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	uid := make([]byte, 16)
+	if _, err := cryptorand.Read(uid); err != nil {
+		return nil, err
+	}
+	dryRun := true
+	gvk := appsv1.SchemeGroupVersion.WithKind("Deployment")
+	review := &admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID(hex.EncodeToString(uid)),
+			Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+			Resource:  metav1.GroupVersionResource{Group: gvk.Group, Version: gvk.Version, Resource: "deployments"},
+			Name:      object.Name,
+			Namespace: object.Namespace,
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: SelfTestName},
+			Object:    runtime.RawExtension{Raw: raw},
+			DryRun:    &dryRun,
+		},
+	}
+	review.SetGroupVersionKind(admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"))
+	return review, nil
+}
+
+// PostReview sends AdmissionReview to the webhook url and returns response body
+func PostReview(ctx context.Context, webhookURL string, tlsConfig *tls.Config, review *admissionv1.AdmissionReview) ([]byte, error) {
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	httpClient := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook returned %s: %s", response.Status, data)
+	}
+	return data, nil
+}
+
+// CheckReviewResponse checks that body is AdmissionReview answering the request review
+func CheckReviewResponse(request *admissionv1.AdmissionReview, body []byte) (*admissionv1.AdmissionResponse, error) {
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil {
+		return nil, fmt.Errorf("response is not AdmissionReview: %w", err)
+	}
+	if review.GroupVersionKind() != request.GroupVersionKind() {
+		return nil, fmt.Errorf("response is %s, expected %s", review.GroupVersionKind(), request.GroupVersionKind())
+	}
+	if review.Response == nil {
+		return nil, fmt.Errorf("response AdmissionReview has no response")
+	}
+	if review.Response.UID != request.Request.UID {
+		return nil, fmt.Errorf("response uid %q doesn't match request uid %q", review.Response.UID, request.Request.UID)
+	}
+	if review.Response.Patch != nil && review.Response.PatchType == nil {
+		return nil, fmt.Errorf("response has patch without patchType")
+	}
+	if !review.Response.Allowed && (review.Response.Result == nil || review.Response.Result.Message == "") {
+		return nil, fmt.Errorf("response denies request without message")
+	}
+	return review.Response, nil
+}
+
+// DryRunDenial returns status of the webhook denial from the dry run create error.
+// An error is returned if the request wasn't denied by the webhook
+func DryRunDenial(err error) (*metav1.Status, error) {
+	var apiStatus apierrors.APIStatus
+	if !errors.As(err, &apiStatus) {
+		return nil, fmt.Errorf("dry run create failed: %w", err)
+	}
+	status := apiStatus.Status()
+	switch {
+	case status.Reason == DeniedReason && status.Code == DeniedCode:
+		return &status, nil
+	case status.Reason == metav1.StatusReasonInternalError:
+		// failures calling webhooks with failurePolicy Fail are returned as internal errors
+		return nil, fmt.Errorf("apiserver failed calling webhook: %w", err)
+	}
+	return nil, fmt.Errorf("dry run create failed: %w", err)
+}
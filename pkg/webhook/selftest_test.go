@@ -0,0 +1,47 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDryRunDenial(t *testing.T) {
+	denied := &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: `admission webhook "gitdeps.example.com" denied the request: gitlab.ci.werf.io/pipeline-url annotation is required`,
+		Reason:  DeniedReason,
+		Code:    DeniedCode,
+	}}
+	tests := []struct {
+		name        string
+		err         error
+		wantMessage string
+		wantErr     bool
+	}{
+		{name: "denied", err: denied, wantMessage: denied.ErrStatus.Message},
+		{name: "wrapped denied", err: fmt.Errorf("create: %w", denied), wantMessage: denied.ErrStatus.Message},
+		{name: "failed calling webhook", err: apierrors.NewInternalError(errors.New(`failed calling webhook "gitdeps.example.com": connection refused`)), wantErr: true},
+		{name: "forbidden", err: apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, SelfTestName, errors.New("no rbac")), wantErr: true},
+		{name: "already exists", err: apierrors.NewAlreadyExists(schema.GroupResource{Group: "apps", Resource: "deployments"}, SelfTestName), wantErr: true},
+		{name: "not api error", err: errors.New("connection refused"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := DryRunDenial(tt.err)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DryRunDenial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if status.Message != tt.wantMessage {
+				t.Errorf("DryRunDenial() message = %q, want %q", status.Message, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// SkipReason returns why the request is allowed without checking the pipeline,
+// empty string is returned if it should be checked
+func SkipReason(WebhookConf config.WebHookConf, request *admissionv1.AdmissionRequest, object, oldObject *unstructured.Unstructured) string {
+	if SkipUser(WebhookConf.Skip, request.UserInfo) {
+		return fmt.Sprintf("requests of %q are not checked", request.UserInfo.Username)
+	}
+	if request.Operation == admissionv1.Update && UnchangedUpdate(oldObject, object) {
+		return "pipeline annotation and pod template are not changed"
+	}
+	return ""
+}
+
+// SkipUser reports whether requests of the user are not checked
+func SkipUser(skip config.SkipConf, userInfo authenticationv1.UserInfo) bool {
+	if contains(skip.Users, userInfo.Username) {
+		return true
+	}
+	for _, group := range userInfo.Groups {
+		if contains(skip.Groups, group) {
+			return true
+		}
+	}
+
+	if !strings.HasPrefix(userInfo.Username, serviceAccountPrefix) {
+		return false
+	}
+	namespace, name, ok := strings.Cut(strings.TrimPrefix(userInfo.Username, serviceAccountPrefix), ":")
+	if !ok {
+		return false
+	}
+	return contains(skip.ServiceAccounts, namespace+"/"+name) || contains(skip.ServiceAccounts, namespace+"/*")
+}
+
+// UnchangedUpdate reports whether update keeps the pipeline annotation and the pod template.
+// spec is compared for objects without pod template, e.g. Services and Ingresses
+func UnchangedUpdate(oldObject, object *unstructured.Unstructured) bool {
+	if oldObject == nil || object == nil {
+		return false
+	}
+	if oldObject.GetAnnotations()[PipelineURLAnnotation] != object.GetAnnotations()[PipelineURLAnnotation] {
+		return false
+	}
+
+	oldTemplate, oldFound, _ := unstructured.NestedFieldNoCopy(oldObject.Object, "spec", "template")
+	template, found, _ := unstructured.NestedFieldNoCopy(object.Object, "spec", "template")
+	if oldFound || found {
+		return reflect.DeepEqual(oldTemplate, template)
+	}
+
+	oldSpec, _, _ := unstructured.NestedFieldNoCopy(oldObject.Object, "spec")
+	spec, _, _ := unstructured.NestedFieldNoCopy(object.Object, "spec")
+	return reflect.DeepEqual(oldSpec, spec)
+}
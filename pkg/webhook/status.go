@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HealthzPath is served by the webhook server for liveness and status checks
+const HealthzPath = "/healthz"
+
+// DescribeClientConfig returns where the apiserver sends requests of the webhook
+func DescribeClientConfig(clientConfig v1.WebhookClientConfig) string {
+	if clientConfig.URL != nil {
+		return fmt.Sprintf("url %s", *clientConfig.URL)
+	}
+	if service := clientConfig.Service; service != nil {
+		port := int32(443)
+		if service.Port != nil {
+			port = *service.Port
+		}
+		return fmt.Sprintf("service %s/%s:%d%s", service.Namespace, service.Name, port, ClientConfigPath(clientConfig))
+	}
+	return "none"
+}
+
+// DescribeRules returns short description of the webhook rules
+func DescribeRules(rules []v1.RuleWithOperations) string {
+	described := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		operations := make([]string, 0, len(rule.Operations))
+		for _, operation := range rule.Operations {
+			operations = append(operations, string(operation))
+		}
+		groups := make([]string, 0, len(rule.APIGroups))
+		for _, group := range rule.APIGroups {
+			if group == "" {
+				group = "core"
+			}
+			groups = append(groups, group)
+		}
+		described = append(described, fmt.Sprintf("%s %s/%s/%s",
+			strings.Join(operations, ","),
+			strings.Join(groups, ","),
+			strings.Join(rule.APIVersions, ","),
+			strings.Join(rule.Resources, ","),
+		))
+	}
+	return strings.Join(described, "; ")
+}
+
+// VerifyServingCertificate checks that the serving certificate is trusted by caBundle for the DNS name
+func VerifyServingCertificate(caBundle []byte, cert *x509.Certificate, dnsName string) error {
+	cas, err := ParseCertificates(caBundle)
+	if err != nil {
+		return fmt.Errorf("failed to parse caBundle: %w", err)
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		DNSName:   dnsName,
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return err
+}
+
+// PeerCertificate returns certificate served at the url host
+func PeerCertificate(ctx context.Context, rawURL string) (*x509.Certificate, error) {
+	webhookURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	address := webhookURL.Host
+	if webhookURL.Port() == "" {
+		address = net.JoinHostPort(webhookURL.Hostname(), "443")
+	}
+	dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s served no certificate", address)
+	}
+	return certs[0], nil
+}
+
+// CheckEndpoint requests health check of the webhook server. Service endpoints are
+// reached through the apiserver proxy, url endpoints directly trusting caBundle
+func CheckEndpoint(ctx context.Context, client kubernetes.Interface, clientConfig v1.WebhookClientConfig) error {
+	if service := clientConfig.Service; service != nil {
+		port := "443"
+		if service.Port != nil {
+			port = fmt.Sprint(*service.Port)
+		}
+		_, err := client.CoreV1().Services(service.Namespace).ProxyGet("https", service.Name, port, HealthzPath, nil).DoRaw(ctx)
+		return err
+	}
+	if clientConfig.URL == nil {
+		return fmt.Errorf("webhook clientConfig has neither service nor url")
+	}
+
+	roots := x509.NewCertPool()
+	if len(clientConfig.CABundle) > 0 {
+		roots.AppendCertsFromPEM(clientConfig.CABundle)
+	}
+	httpClient := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, urlWithPath(*clientConfig.URL, HealthzPath), nil)
+	if err != nil {
+		return err
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hashicorp/go-hclog"
+)
+
+// KeypairFromFiles returns keypair loaded from PEM encoded certificate and key files
+func KeypairFromFiles(certFile, keyFile string) (*Keypair, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeypair(certPEM, keyPEM)
+}
+
+// WatchKeypair reloads keypair whenever files in the certificate directory change,
+// until ctx is done. Kubernetes updates mounted Secrets by swapping a symlink,
+// so the directory is watched instead of the files themselves.
+func WatchKeypair(ctx context.Context, keypair *Keypair, certFile, keyFile string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dirs := map[string]struct{}{
+		filepath.Dir(certFile): {},
+		filepath.Dir(keyFile):  {},
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %q: %w", dir, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			hclog.L().Debug("Certificate directory changed", "event", event.String())
+			if err := reloadKeypair(keypair, certFile, keyFile); err != nil {
+				// files may be written one after another, wait for the next event
+				hclog.L().Warn(fmt.Sprintf("failed to reload certificate: %v", err))
+				continue
+			}
+			hclog.L().Info("Reloaded webhook certificate", "file", certFile)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			hclog.L().Error(fmt.Sprintf("certificate watcher error: %v", err))
+		}
+	}
+}
+
+func reloadKeypair(keypair *Keypair, certFile, keyFile string) error {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	return keypair.Update(certPEM, keyPEM)
+}
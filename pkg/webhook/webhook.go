@@ -3,213 +3,436 @@ package webhook
 import (
 	"bytes"
 	"context"
-	cryptorand "crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"math/big"
-	"os"
-	"path"
-	"time"
+	"net/url"
 
 	"github.com/alex123012/gitdeps/pkg/config"
 	"github.com/hashicorp/go-hclog"
 	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	v1Typed "k8s.io/client-go/kubernetes/typed/admissionregistration/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 )
 
-func GenerateCertificate(WebhookConf config.WebHookConf, toFile bool) (map[string]*bytes.Buffer, error) {
-	certsPath := WebhookConf.Tls.Path
-	certificateFile := path.Join(certsPath, WebhookConf.Tls.CertFile)
-	keyFile := path.Join(certsPath, WebhookConf.Tls.KeyFile)
-	organization := WebhookConf.Tls.Organization
-	if toFile {
-		if _, err := os.Stat(certificateFile); errors.Is(err, os.ErrNotExist) {
-			return nil, fmt.Errorf("not valid certificate path: %w", err)
-		}
-		if _, err := os.Stat(keyFile); errors.Is(err, os.ErrNotExist) {
-			return nil, fmt.Errorf("not valid key path: %w", err)
+// ValidatingWebhookConfiguration returns configuration for the webhook from config,
+// caBundle is left empty if caPEM is nil
+func ValidatingWebhookConfiguration(caPEM *bytes.Buffer, WebhookConf config.WebHookConf) *v1.ValidatingWebhookConfiguration {
+	webhooks := ValidatingWebhooks(WebhookConf)
+	if caPEM != nil {
+		for i := range webhooks {
+			webhooks[i].ClientConfig.CABundle = caPEM.Bytes()
 		}
 	}
+	return &v1.ValidatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.SchemeGroupVersion.String(),
+			Kind:       "ValidatingWebhookConfiguration",
+		},
+		ObjectMeta: webhookMetadata(WebhookConf),
+		Webhooks:   webhooks,
+	}
+}
 
-	var caPEM, serverCertPEM, serverPrivKeyPEM *bytes.Buffer
-	// CA config
-	ca := &x509.Certificate{
-		SerialNumber: big.NewInt(2020),
-		Subject: pkix.Name{
-			Organization: []string{organization},
+// MutatingWebhookConfiguration returns configuration for the mutating webhook from config,
+// caBundle is left empty if caPEM is nil
+func MutatingWebhookConfiguration(caPEM *bytes.Buffer, WebhookConf config.WebHookConf) *v1.MutatingWebhookConfiguration {
+	webhook := MutatingWebhook(WebhookConf)
+	if caPEM != nil {
+		webhook.ClientConfig.CABundle = caPEM.Bytes()
+	}
+	return &v1.MutatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1.SchemeGroupVersion.String(),
+			Kind:       "MutatingWebhookConfiguration",
 		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1, 0, 0),
-		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		BasicConstraintsValid: true,
+		ObjectMeta: webhookMetadata(WebhookConf),
+		Webhooks:   []v1.MutatingWebhook{webhook},
 	}
+}
+
+// CreateWebhookConf server-side applies the validating webhook configuration from config.
+// caBundle is not applied if caPEM is nil, so the one injected by cert-manager is kept.
+func CreateWebhookConf(ctx context.Context, config *rest.Config, caPEM *bytes.Buffer, WebhookConf config.WebHookConf, matchConditions bool) error {
 
-	// CA private key
-	caPrivKey, err := rsa.GenerateKey(cryptorand.Reader, 4096)
+	api, err := AdmissionApiFromConfig(config)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Self signed CA certificate
-	caBytes, err := x509.CreateCertificate(cryptorand.Reader, ca, ca, &caPrivKey.PublicKey, caPrivKey)
+	webHookConfResource := ValidatingWebhookConfiguration(caPEM, WebhookConf)
+	data, err := applyData(webHookConfResource, WebhookConf, matchConditions)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// PEM encode CA cert
-	caPEM = new(bytes.Buffer)
-	err = pem.Encode(caPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: caBytes,
-	})
-
+	hclog.L().Info("Applying ValidatingWebhookConfiguration")
+	check, err := api.Patch(ctx, webHookConfResource.Name, types.ApplyPatchType, data, applyOptions())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	serviceName := WebhookConf.Webhook.ClientConfig.Service.Name
-	serviceNamespace := WebhookConf.Webhook.ClientConfig.Service.Namespace
-	nameNamespace := fmt.Sprintf("%s.%s", serviceName, serviceNamespace)
 
-	commonName := fmt.Sprintf("%s.svc", nameNamespace)
+	if check.ObjectMeta.Name != webHookConfResource.ObjectMeta.Name {
+		return fmt.Errorf("something went wrong with creating Validaton Webhook")
+	}
+	return nil
+}
 
-	dnsNames := []string{
-		serviceName,
-		nameNamespace,
-		commonName,
+// PatchCABundle sets caBundle of every webhook in the configurations from config.
+// Configurations that don't exist yet are skipped. Configurations are patched
+// instead of updated, so fields unknown to the client such as matchConditions are kept.
+func PatchCABundle(ctx context.Context, config *rest.Config, caBundle []byte, WebhookConf config.WebHookConf) error {
+	api, err := AdmissionApiFromConfig(config)
+	if err != nil {
+		return err
 	}
+	name := WebhookConf.Metadata.Name
 
-	// server cert config
-	cert := &x509.Certificate{
-		DNSNames:     dnsNames,
-		SerialNumber: big.NewInt(1658),
-		Subject: pkix.Name{
-			CommonName:   commonName,
-			Organization: []string{organization},
-		},
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().AddDate(1, 0, 0),
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:     x509.KeyUsageDigitalSignature,
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		result, err := api.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current := make([][]byte, 0, len(result.Webhooks))
+		for _, webhook := range result.Webhooks {
+			current = append(current, webhook.ClientConfig.CABundle)
+		}
+		patch, changed, err := caBundlePatch(result.ResourceVersion, current, caBundle)
+		if err != nil || !changed {
+			return err
+		}
+		hclog.L().Info("Updating caBundle of ValidatingWebhookConfiguration")
+		_, err = api.Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
 	}
 
-	// server private key
-	serverPrivKey, err := rsa.GenerateKey(cryptorand.Reader, 4096)
+	if !WebhookConf.Mutating.Enabled {
+		return nil
+	}
+
+	mutatingApi, err := MutatingAdmissionApiFromConfig(config)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		result, err := mutatingApi.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current := make([][]byte, 0, len(result.Webhooks))
+		for _, webhook := range result.Webhooks {
+			current = append(current, webhook.ClientConfig.CABundle)
+		}
+		patch, changed, err := caBundlePatch(result.ResourceVersion, current, caBundle)
+		if err != nil || !changed {
+			return err
+		}
+		hclog.L().Info("Updating caBundle of MutatingWebhookConfiguration")
+		_, err = mutatingApi.Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
 	}
+	return nil
+}
 
-	// sign the server cert
-	serverCertBytes, err := x509.CreateCertificate(cryptorand.Reader, cert, ca, &serverPrivKey.PublicKey, caPrivKey)
+// LiveCABundles returns caBundles of the registered webhook configurations,
+// nothing is returned for configurations that don't exist
+func LiveCABundles(ctx context.Context, config *rest.Config, WebhookConf config.WebHookConf) ([][]byte, error) {
+	api, err := AdmissionApiFromConfig(config)
 	if err != nil {
 		return nil, err
 	}
+	name := WebhookConf.Metadata.Name
 
-	// PEM encode the  server cert and key
-	serverCertPEM = new(bytes.Buffer)
-	err = pem.Encode(serverCertPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: serverCertBytes,
-	})
+	var bundles [][]byte
+	validating, err := api.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		for _, webhook := range validating.Webhooks {
+			bundles = append(bundles, webhook.ClientConfig.CABundle)
+		}
+	}
 
+	if !WebhookConf.Mutating.Enabled {
+		return bundles, nil
+	}
+	mutatingApi, err := MutatingAdmissionApiFromConfig(config)
 	if err != nil {
 		return nil, err
 	}
+	mutating, err := mutatingApi.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		for _, webhook := range mutating.Webhooks {
+			bundles = append(bundles, webhook.ClientConfig.CABundle)
+		}
+	}
+	return bundles, nil
+}
 
-	serverPrivKeyPEM = new(bytes.Buffer)
-	err = pem.Encode(serverPrivKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(serverPrivKey),
-	})
+// caBundlePatch returns JSONPatch that sets caBundle of every webhook.
+// resourceVersion is set too, so the patch fails with conflict
+// if the configuration was changed after it was read
+func caBundlePatch(resourceVersion string, current [][]byte, caBundle []byte) ([]byte, bool, error) {
+	ops := []map[string]interface{}{{
+		"op":    "replace",
+		"path":  "/metadata/resourceVersion",
+		"value": resourceVersion,
+	}}
+	for i := range current {
+		if bytes.Equal(current[i], caBundle) {
+			continue
+		}
+		ops = append(ops, map[string]interface{}{
+			"op":    "add",
+			"path":  fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i),
+			"value": caBundle,
+		})
+	}
+	if len(ops) == 1 {
+		return nil, false, nil
+	}
+	patch, err := json.Marshal(ops)
+	return patch, true, err
+}
+
+func AdmissionApiFromConfig(config *rest.Config) (v1Typed.ValidatingWebhookConfigurationInterface, error) {
+	k8sClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
 	}
+	return k8sClient.AdmissionregistrationV1().ValidatingWebhookConfigurations(), nil
+}
 
-	if toFile {
-		err = os.MkdirAll(certsPath, 0666)
-		if err != nil {
-			return nil, err
+// ValidatingWebhooks returns validating webhooks from config,
+// fields that are not set are taken from the primary webhook
+func ValidatingWebhooks(WebhookConf config.WebHookConf) []v1.ValidatingWebhook {
+	primary := WebhookConf.Webhook
+	if len(WebhookConf.Webhooks) == 0 {
+		webhook := *primary.DeepCopy()
+		setPolicySelectors(&webhook.NamespaceSelector, &webhook.ObjectSelector, WebhookConf, webhook.Name)
+		return []v1.ValidatingWebhook{webhook}
+	}
+
+	webhooks := make([]v1.ValidatingWebhook, 0, len(WebhookConf.Webhooks))
+	for i := range WebhookConf.Webhooks {
+		webhook := *WebhookConf.Webhooks[i].DeepCopy()
+
+		if webhook.Name == "" {
+			webhook.Name = fmt.Sprintf("%d.%s", i, primary.Name)
 		}
-		err = WriteFile(certificateFile, serverCertPEM)
-		if err != nil {
-			return nil, err
+		if webhook.ClientConfig.URL == nil && primary.ClientConfig.URL != nil {
+			webhookURL := *primary.ClientConfig.URL
+			if override := webhook.ClientConfig.Service; override != nil && override.Path != nil {
+				webhookURL = urlWithPath(webhookURL, *override.Path)
+			}
+			webhook.ClientConfig.URL = &webhookURL
+			webhook.ClientConfig.Service = nil
+		}
+		if webhook.ClientConfig.URL == nil && primary.ClientConfig.Service != nil {
+			service := primary.ClientConfig.Service.DeepCopy()
+			if override := webhook.ClientConfig.Service; override != nil {
+				if override.Path != nil {
+					service.Path = override.Path
+				}
+				if override.Port != nil {
+					service.Port = override.Port
+				}
+			}
+			webhook.ClientConfig.Service = service
+		}
+		if len(webhook.Rules) == 0 {
+			webhook.Rules = primary.Rules
+		}
+		if webhook.FailurePolicy == nil {
+			webhook.FailurePolicy = primary.FailurePolicy
+		}
+		if webhook.MatchPolicy == nil {
+			webhook.MatchPolicy = primary.MatchPolicy
+		}
+		if webhook.SideEffects == nil {
+			webhook.SideEffects = primary.SideEffects
+		}
+		if webhook.TimeoutSeconds == nil {
+			webhook.TimeoutSeconds = primary.TimeoutSeconds
 		}
+		if len(webhook.AdmissionReviewVersions) == 0 {
+			webhook.AdmissionReviewVersions = primary.AdmissionReviewVersions
+		}
+		if webhook.NamespaceSelector == nil && primary.NamespaceSelector != nil {
+			webhook.NamespaceSelector = primary.NamespaceSelector.DeepCopy()
+		}
+		if webhook.ObjectSelector == nil && primary.ObjectSelector != nil {
+			webhook.ObjectSelector = primary.ObjectSelector.DeepCopy()
+		}
+		setPolicySelectors(&webhook.NamespaceSelector, &webhook.ObjectSelector, WebhookConf, webhook.Name)
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks
+}
 
-		err = WriteFile(keyFile, serverPrivKeyPEM)
-		if err != nil {
-			return nil, err
+// WebhookPaths returns service or url paths of the validating webhooks
+// with names of the webhooks served on each path
+func WebhookPaths(WebhookConf config.WebHookConf) map[string][]string {
+	paths := make(map[string][]string)
+	for _, webhook := range ValidatingWebhooks(WebhookConf) {
+		webhookPath := ClientConfigPath(webhook.ClientConfig)
+		paths[webhookPath] = append(paths[webhookPath], webhook.Name)
+	}
+	return paths
+}
+
+// ClientConfigPath returns path the apiserver sends requests to
+func ClientConfigPath(clientConfig v1.WebhookClientConfig) string {
+	switch {
+	case clientConfig.Service != nil && clientConfig.Service.Path != nil:
+		return *clientConfig.Service.Path
+	case clientConfig.URL != nil:
+		if webhookURL, err := url.Parse(*clientConfig.URL); err == nil && webhookURL.Path != "" {
+			return webhookURL.Path
 		}
 	}
-	return map[string]*bytes.Buffer{
-		"ca":   caPEM,
-		"cert": serverCertPEM,
-		"key":  serverPrivKeyPEM,
-	}, nil
+	return "/"
 }
 
-// WriteFile writes data in the file at the given path
-func WriteFile(filepath string, sCert *bytes.Buffer) error {
-	f, err := os.Create(filepath)
+// urlWithPath returns url with path replaced
+func urlWithPath(rawURL, urlPath string) string {
+	webhookURL, err := url.Parse(rawURL)
 	if err != nil {
-		return err
+		return rawURL
 	}
-	defer f.Close()
+	webhookURL.Path = urlPath
+	return webhookURL.String()
+}
 
-	_, err = f.Write(sCert.Bytes())
-	if err != nil {
-		return err
+// MutatingWebhook returns mutating webhook from config,
+// fields that are not set are taken from the validating webhook
+func MutatingWebhook(WebhookConf config.WebHookConf) v1.MutatingWebhook {
+	validating := WebhookConf.Webhook
+	webhook := *WebhookConf.Mutating.Webhook.DeepCopy()
+
+	if webhook.Name == "" {
+		webhook.Name = fmt.Sprintf("mutate.%s", validating.Name)
 	}
-	return nil
+	if webhook.ClientConfig.Service == nil && webhook.ClientConfig.URL == nil && validating.ClientConfig.Service != nil {
+		service := validating.ClientConfig.Service.DeepCopy()
+		mutatePath := "/mutate"
+		service.Path = &mutatePath
+		webhook.ClientConfig.Service = service
+	}
+	if webhook.ClientConfig.Service == nil && webhook.ClientConfig.URL == nil && validating.ClientConfig.URL != nil {
+		mutateURL := urlWithPath(*validating.ClientConfig.URL, "/mutate")
+		webhook.ClientConfig.URL = &mutateURL
+	}
+	if len(webhook.Rules) == 0 {
+		webhook.Rules = validating.Rules
+	}
+	if webhook.FailurePolicy == nil {
+		webhook.FailurePolicy = validating.FailurePolicy
+	}
+	if webhook.NamespaceSelector == nil {
+		webhook.NamespaceSelector = validating.NamespaceSelector
+	}
+	if webhook.ObjectSelector == nil {
+		webhook.ObjectSelector = validating.ObjectSelector
+	}
+	setPolicySelectors(&webhook.NamespaceSelector, &webhook.ObjectSelector, WebhookConf, webhook.Name)
+	if webhook.SideEffects == nil {
+		webhook.SideEffects = validating.SideEffects
+	}
+	if webhook.TimeoutSeconds == nil {
+		webhook.TimeoutSeconds = validating.TimeoutSeconds
+	}
+	if len(webhook.AdmissionReviewVersions) == 0 {
+		webhook.AdmissionReviewVersions = validating.AdmissionReviewVersions
+	}
+	return webhook
 }
 
-func CreateWebhookConf(ctx context.Context, config *rest.Config, caPEM *bytes.Buffer, WebhookConf config.WebHookConf) error {
+// CreateMutatingWebhookConf server-side applies the mutating webhook configuration from config
+func CreateMutatingWebhookConf(ctx context.Context, config *rest.Config, caPEM *bytes.Buffer, WebhookConf config.WebHookConf, matchConditions bool) error {
 
-	api, err := AdmissionApiFromConfig(config)
+	api, err := MutatingAdmissionApiFromConfig(config)
 	if err != nil {
 		return err
 	}
 
-	WebhookConf.Webhook.ClientConfig.CABundle = caPEM.Bytes()
-	webHookConfResource := &v1.ValidatingWebhookConfiguration{
-		ObjectMeta: WebhookConf.Metadata,
-		Webhooks:   []v1.ValidatingWebhook{WebhookConf.Webhook},
-	}
-	hclog.L().Info("Trying to get WebhookConfiguration")
-	result, err := api.Get(ctx, webHookConfResource.ObjectMeta.Name, metav1.GetOptions{})
-	var check *v1.ValidatingWebhookConfiguration
-
+	webHookConfResource := MutatingWebhookConfiguration(caPEM, WebhookConf)
+	data, err := applyData(webHookConfResource, WebhookConf, matchConditions)
 	if err != nil {
-		hclog.L().Info("Creating WebhookConfiguration")
-		check, err = api.Create(ctx, webHookConfResource, metav1.CreateOptions{})
-	} else {
-		hclog.L().Info("Updating WebhookConfiguration")
-		webHookConfResource.ObjectMeta = result.ObjectMeta
-		check, err = api.Update(ctx, webHookConfResource, metav1.UpdateOptions{})
+		return err
 	}
 
+	hclog.L().Info("Applying MutatingWebhookConfiguration")
+	check, err := api.Patch(ctx, webHookConfResource.Name, types.ApplyPatchType, data, applyOptions())
 	if err != nil {
 		return err
 	}
 
 	if check.ObjectMeta.Name != webHookConfResource.ObjectMeta.Name {
-		return fmt.Errorf("something went wrong with creating Validaton Webhook")
+		return fmt.Errorf("something went wrong with creating Mutating Webhook")
 	}
 	return nil
 }
 
-func AdmissionApiFromConfig(config *rest.Config) (v1Typed.ValidatingWebhookConfigurationInterface, error) {
+func MutatingAdmissionApiFromConfig(config *rest.Config) (v1Typed.MutatingWebhookConfigurationInterface, error) {
 	k8sClient, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
 	}
-	return k8sClient.AdmissionregistrationV1().ValidatingWebhookConfigurations(), nil
+	return k8sClient.AdmissionregistrationV1().MutatingWebhookConfigurations(), nil
+}
+
+// webhookMetadata returns metadata from config with ownership labels
+func webhookMetadata(WebhookConf config.WebHookConf) metav1.ObjectMeta {
+	meta := *WebhookConf.Metadata.DeepCopy()
+	if meta.Labels == nil {
+		meta.Labels = make(map[string]string)
+	}
+	for key, value := range OwnershipLabels(WebhookConf) {
+		meta.Labels[key] = value
+	}
+	return meta
+}
+
+// applyData returns server-side apply body of the webhook configuration
+func applyData(object runtime.Object, WebhookConf config.WebHookConf, matchConditions bool) ([]byte, error) {
+	if matchConditions {
+		withConditions, err := WithMatchConditions(object, WebhookConf)
+		if err != nil {
+			return nil, err
+		}
+		object = withConditions
+	}
+	return json.Marshal(object)
+}
+
+// setPolicySelectors sets selectors derived from policies if they are not set explicitly
+func setPolicySelectors(namespaceSelector, objectSelector **metav1.LabelSelector, WebhookConf config.WebHookConf, webhookName string) {
+	policyNamespaceSelector, policyObjectSelector := PolicySelectors(WebhookConf, webhookName)
+	if *namespaceSelector == nil {
+		*namespaceSelector = policyNamespaceSelector
+	}
+	if *objectSelector == nil {
+		*objectSelector = policyObjectSelector
+	}
+}
+
+func applyOptions() metav1.PatchOptions {
+	force := true
+	return metav1.PatchOptions{FieldManager: FieldManager, Force: &force}
 }
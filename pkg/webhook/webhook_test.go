@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alex123012/gitdeps/pkg/config"
+	v1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidatingWebhooksSelectors(t *testing.T) {
+	primaryNamespaces := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "production"}}
+	primaryObjects := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	ownNamespaces := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "staging"}}
+
+	tests := []struct {
+		name           string
+		webhook        v1.ValidatingWebhook
+		wantNamespaces *metav1.LabelSelector
+		wantObjects    *metav1.LabelSelector
+	}{
+		{
+			name:           "inherits selectors",
+			webhook:        v1.ValidatingWebhook{Name: "a.gitdeps.io"},
+			wantNamespaces: primaryNamespaces,
+			wantObjects:    primaryObjects,
+		},
+		{
+			name:           "keeps own selector",
+			webhook:        v1.ValidatingWebhook{Name: "b.gitdeps.io", NamespaceSelector: ownNamespaces},
+			wantNamespaces: ownNamespaces,
+			wantObjects:    primaryObjects,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.WebHookConf{
+				Webhook: v1.ValidatingWebhook{
+					Name:              "gitdeps.io",
+					NamespaceSelector: primaryNamespaces,
+					ObjectSelector:    primaryObjects,
+				},
+				Webhooks: []v1.ValidatingWebhook{tt.webhook},
+			}
+			webhooks := ValidatingWebhooks(conf)
+			if len(webhooks) != 1 {
+				t.Fatalf("got %d webhooks, want 1", len(webhooks))
+			}
+			if got := webhooks[0].NamespaceSelector; !reflect.DeepEqual(got, tt.wantNamespaces) {
+				t.Errorf("namespaceSelector = %v, want %v", got, tt.wantNamespaces)
+			}
+			if got := webhooks[0].ObjectSelector; !reflect.DeepEqual(got, tt.wantObjects) {
+				t.Errorf("objectSelector = %v, want %v", got, tt.wantObjects)
+			}
+		})
+	}
+}